@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	helmCrdV1 "github.com/bitnami-labs/helm-crd/pkg/apis/helm.bitnami.com/v1"
+	chartUtils "github.com/bitnami-labs/helm-crd/pkg/utils/chart"
+)
+
+// Maximum number of cached HTTP clients with custom TLS settings
+const maxTLSClients = 64
+
+// secretAllowlist lists the Secrets that HelmReleases may reference
+// outside of their own namespace
+type secretAllowlist []secretAllowlistEntry
+
+type secretAllowlistEntry struct {
+	// releaseNamespace is the namespace of the HelmReleases the entry
+	// applies to, "*" for all
+	releaseNamespace string
+	namespace        string
+	// name of the Secret, "*" for all the Secrets in namespace
+	name string
+}
+
+// parseSecretAllowlist parses entries of the form
+// [<release namespace>:]<secret namespace>/<secret name>, where the
+// release namespace and secret name can be "*"
+func parseSecretAllowlist(entries []string) (secretAllowlist, error) {
+	var allowlist secretAllowlist
+	for _, e := range entries {
+		entry := secretAllowlistEntry{releaseNamespace: "*"}
+		ref := e
+		if i := strings.Index(ref, ":"); i != -1 {
+			entry.releaseNamespace, ref = ref[:i], ref[i+1:]
+		}
+		parts := strings.Split(ref, "/")
+		if len(parts) != 2 || entry.releaseNamespace == "" || parts[0] == "" || parts[0] == "*" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid secret allowlist entry %q, expected [<release namespace>:]<secret namespace>/<secret name>", e)
+		}
+		entry.namespace, entry.name = parts[0], parts[1]
+		allowlist = append(allowlist, entry)
+	}
+	return allowlist, nil
+}
+
+// allows returns true if HelmReleases in releaseNamespace may reference
+// the Secret namespace/name
+func (a secretAllowlist) allows(releaseNamespace, namespace, name string) bool {
+	if releaseNamespace == namespace {
+		return true
+	}
+	for _, e := range a {
+		if (e.releaseNamespace == "*" || e.releaseNamespace == releaseNamespace) &&
+			e.namespace == namespace &&
+			(e.name == "*" || e.name == name) {
+			return true
+		}
+	}
+	return false
+}
+
+// getSecret returns a Secret referenced by an object in
+// ownerNamespace, if the allowlist permits it. An empty namespace is
+// the owner's namespace. Cluster-scoped owners (empty ownerNamespace)
+// are created by cluster admins, so they may reference any Secret but
+// must give its namespace.
+func (c *Controller) getSecret(ownerNamespace, namespace, name string) (*corev1.Secret, error) {
+	if namespace == "" {
+		if ownerNamespace == "" {
+			return nil, withReason(reasonInvalidAuth, fmt.Errorf("secret %s referenced from a cluster-scoped resource must have a namespace", name))
+		}
+		namespace = ownerNamespace
+	}
+	if ownerNamespace != "" && !c.secretAllowlist.allows(ownerNamespace, namespace, name) {
+		return nil, withReason(reasonAuthSecretForbidden, fmt.Errorf("secret %s/%s is not allowed to be referenced from namespace %s", namespace, name, ownerNamespace))
+	}
+	secret, err := c.kubeClient.Core().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, withReason(reasonAuthSecretError, err)
+	}
+	return secret, nil
+}
+
+// getConfigMap returns a ConfigMap referenced by an object in
+// ownerNamespace, with the same rules as getSecret: ConfigMaps outside
+// of the owner's namespace must be allowed by the Secret allowlist.
+func (c *Controller) getConfigMap(ownerNamespace, namespace, name string) (*corev1.ConfigMap, error) {
+	if namespace == "" {
+		if ownerNamespace == "" {
+			return nil, withReason(reasonInvalidAuth, fmt.Errorf("configmap %s referenced from a cluster-scoped resource must have a namespace", name))
+		}
+		namespace = ownerNamespace
+	}
+	if ownerNamespace != "" && !c.secretAllowlist.allows(ownerNamespace, namespace, name) {
+		return nil, withReason(reasonAuthSecretForbidden, fmt.Errorf("configmap %s/%s is not allowed to be referenced from namespace %s", namespace, name, ownerNamespace))
+	}
+	cm, err := c.kubeClient.Core().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, withReason(reasonAuthSecretError, err)
+	}
+	return cm, nil
+}
+
+func secretValue(secret *corev1.Secret, key string) ([]byte, error) {
+	value, ok := secret.Data[key]
+	if !ok {
+		return nil, withReason(reasonAuthSecretError, fmt.Errorf("key %q not found in Secret %s/%s", key, secret.Namespace, secret.Name))
+	}
+	return value, nil
+}
+
+// authHeader returns the Authorization header to send to the chart
+// repository, read from the Secret referenced in auth
+func (c *Controller) authHeader(ownerNamespace string, auth *helmCrdV1.HelmReleaseAuth) (string, error) {
+	set := 0
+	for _, isSet := range []bool{auth.Header != nil, auth.Basic != nil, auth.BearerToken != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set > 1 {
+		return "", withReason(reasonInvalidAuth, fmt.Errorf("only one of auth.header, auth.basic and auth.bearerToken can be set"))
+	}
+
+	switch {
+	case auth.Header != nil:
+		secret, err := c.getSecret(ownerNamespace, auth.Header.Namespace, auth.Header.SecretKeyRef.Name)
+		if err != nil {
+			return "", err
+		}
+		value, err := secretValue(secret, auth.Header.SecretKeyRef.Key)
+		return string(value), err
+
+	case auth.Basic != nil:
+		secret, err := c.getSecret(ownerNamespace, auth.Basic.Namespace, auth.Basic.SecretRef.Name)
+		if err != nil {
+			return "", err
+		}
+		username, err := secretValue(secret, corev1.BasicAuthUsernameKey)
+		if err != nil {
+			return "", err
+		}
+		password, err := secretValue(secret, corev1.BasicAuthPasswordKey)
+		if err != nil {
+			return "", err
+		}
+		return chartUtils.BasicAuthHeader(string(username), string(password)), nil
+
+	case auth.BearerToken != nil:
+		secret, err := c.getSecret(ownerNamespace, auth.BearerToken.Namespace, auth.BearerToken.SecretKeyRef.Name)
+		if err != nil {
+			return "", err
+		}
+		token, err := secretValue(secret, auth.BearerToken.SecretKeyRef.Key)
+		if err != nil {
+			return "", err
+		}
+		return chartUtils.BearerAuthHeader(strings.TrimSpace(string(token))), nil
+	}
+	return "", nil
+}
+
+// tlsCertificates returns the PEM encoded CA certificates and client
+// certificate and key referenced in auth.tls
+func (c *Controller) tlsCertificates(ownerNamespace string, auth *helmCrdV1.HelmReleaseAuth) (caPEM, certPEM, keyPEM []byte, err error) {
+	t := auth.TLS
+	if t == nil {
+		return nil, nil, nil, nil
+	}
+	if t.CASecretKeyRef != nil && t.CAConfigMapKeyRef != nil {
+		return nil, nil, nil, withReason(reasonInvalidAuth, fmt.Errorf("only one of auth.tls.caSecretKeyRef and auth.tls.caConfigMapKeyRef can be set"))
+	}
+
+	switch {
+	case t.CASecretKeyRef != nil:
+		secret, err := c.getSecret(ownerNamespace, t.Namespace, t.CASecretKeyRef.Name)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if caPEM, err = secretValue(secret, t.CASecretKeyRef.Key); err != nil {
+			return nil, nil, nil, err
+		}
+	case t.CAConfigMapKeyRef != nil:
+		ref := t.CAConfigMapKeyRef
+		cm, err := c.getConfigMap(ownerNamespace, t.Namespace, ref.Name)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		value, ok := cm.Data[ref.Key]
+		if !ok {
+			return nil, nil, nil, withReason(reasonAuthSecretError, fmt.Errorf("key %q not found in ConfigMap %s/%s", ref.Key, cm.Namespace, ref.Name))
+		}
+		caPEM = []byte(value)
+	}
+	if t.ClientCertSecretRef != nil {
+		secret, err := c.getSecret(ownerNamespace, t.Namespace, t.ClientCertSecretRef.Name)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if certPEM, err = secretValue(secret, corev1.TLSCertKey); err != nil {
+			return nil, nil, nil, err
+		}
+		if keyPEM, err = secretValue(secret, corev1.TLSPrivateKeyKey); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return caPEM, certPEM, keyPEM, nil
+}
+
+// httpClient returns the client to access a chart repository with the
+// TLS settings in auth, and a hash identifying these settings ("" for
+// the default client) to key what it downloads by. Clients with custom
+// TLS settings are cached, so connections can be reused across
+// reconciles.
+func (c *Controller) httpClient(ownerNamespace string, auth *helmCrdV1.HelmReleaseAuth) (*chartUtils.HTTPClient, string, error) {
+	caPEM, certPEM, keyPEM, err := c.tlsCertificates(ownerNamespace, auth)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(caPEM) == 0 && len(certPEM) == 0 && len(keyPEM) == 0 {
+		return c.netClient, "", nil
+	}
+
+	h := sha256.New()
+	for _, pem := range [][]byte{caPEM, certPEM, keyPEM} {
+		fmt.Fprintf(h, "%d:", len(pem))
+		h.Write(pem)
+	}
+	key := fmt.Sprintf("%x", h.Sum(nil))
+
+	c.tlsClientsMutex.Lock()
+	defer c.tlsClientsMutex.Unlock()
+	if client, ok := c.tlsClients[key]; ok {
+		return client, key, nil
+	}
+	config, err := chartUtils.TLSConfig(caPEM, certPEM, keyPEM)
+	if err != nil {
+		return nil, "", withReason(reasonInvalidAuth, err)
+	}
+	if len(c.tlsClients) >= maxTLSClients {
+		// Drop clients of rotated certificates
+		c.tlsClients = nil
+	}
+	if c.tlsClients == nil {
+		c.tlsClients = map[string]*chartUtils.HTTPClient{}
+	}
+	client := c.newHTTPClient(config)
+	c.tlsClients[key] = &client
+	return &client, key, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseSecretAllowlist(t *testing.T) {
+	allowlist, err := parseSecretAllowlist([]string{"kube-system/creds", "myns:shared/*"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	tests := []struct {
+		releaseNamespace, namespace, name string
+		expected                          bool
+	}{
+		{"myns", "myns", "anything", true},
+		{"myns", "kube-system", "creds", true},
+		{"otherns", "kube-system", "creds", true},
+		{"myns", "kube-system", "other", false},
+		{"myns", "shared", "other", true},
+		{"otherns", "shared", "other", false},
+		{"myns", "default", "creds", false},
+	}
+	for _, tt := range tests {
+		if res := allowlist.allows(tt.releaseNamespace, tt.namespace, tt.name); res != tt.expected {
+			t.Errorf("Expected %v for %s referencing %s/%s received %v", tt.expected, tt.releaseNamespace, tt.namespace, tt.name, res)
+		}
+	}
+
+	for _, entry := range []string{"creds", "*/creds", "kube-system/", ":kube-system/creds", "a/b/c"} {
+		if _, err := parseSecretAllowlist([]string{entry}); err == nil {
+			t.Errorf("Expected error parsing %q", entry)
+		}
+	}
+}
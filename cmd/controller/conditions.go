@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/helm/pkg/proto/hapi/release"
+
+	helmCrdV1 "github.com/bitnami-labs/helm-crd/pkg/apis/helm.bitnami.com/v1"
+)
+
+// Reasons used in HelmRelease and HelmRepository conditions and events. These are part of
+// the observable API: alerts and tooling match on them.
+const (
+	// Reconciling stages
+	reasonFetchingRepoIndex = "FetchingRepoIndex"
+	reasonFetchingChart     = "FetchingChart"
+	reasonInstalling        = "Installing"
+	reasonUpgrading         = "Upgrading"
+	reasonCheckingStatus    = "CheckingStatus"
+	reasonRollingBack       = "RollingBack"
+
+	// Events only
+	reasonInstalled        = "Installed"
+	reasonUpgraded         = "Upgraded"
+	reasonDeleted          = "Deleted"
+	reasonDeleteFailed     = "DeleteFailed"
+	reasonRetriesExhausted = "RetriesExhausted"
+	reasonDriftDetected    = "DriftDetected"
+	reasonNewChartVersion  = "NewChartVersion"
+
+	// HelmRepository conditions
+	reasonIndexFetched = "IndexFetched"
+
+	// Outcomes
+	reasonReleaseDeployed      = "ReleaseDeployed"
+	reasonReleaseNotDeployed   = "ReleaseNotDeployed"
+	reasonReleaseStatusFailed  = "ReleaseStatusFailed"
+	reasonAuthSecretError      = "AuthSecretError"
+	reasonAuthSecretForbidden  = "AuthSecretForbidden"
+	reasonInvalidAuth          = "InvalidAuth"
+	reasonValuesSourceError    = "ValuesSourceError"
+	reasonInvalidValues        = "InvalidValues"
+	reasonRepoIndexFetchFailed = "RepoIndexFetchFailed"
+	reasonRepositoryNotFound   = "RepositoryNotFound"
+	reasonChartNotFound        = "ChartNotFound"
+	reasonChartFetchFailed     = "ChartFetchFailed"
+	reasonVerificationFailed   = "VerificationFailed"
+	reasonReleaseHistoryFailed = "ReleaseHistoryFailed"
+	reasonInstallFailed        = "InstallFailed"
+	reasonUpgradeFailed        = "UpgradeFailed"
+	reasonRolledBack           = "RolledBack"
+	reasonRollbackFailed       = "RollbackFailed"
+	reasonReconcileFailed      = "ReconcileFailed"
+)
+
+// reconcileError is an error annotated with the condition reason it
+// should be reported as.
+type reconcileError struct {
+	reason string
+	err    error
+}
+
+func (e *reconcileError) Error() string {
+	return e.err.Error()
+}
+
+// withReason annotates err with a condition reason
+func withReason(reason string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &reconcileError{reason: reason, err: err}
+}
+
+// errorReason returns the condition reason err was annotated with,
+// or a generic reason if it has none
+func errorReason(err error) string {
+	if e, ok := err.(*reconcileError); ok {
+		return e.reason
+	}
+	return reasonReconcileFailed
+}
+
+// getCondition returns the condition of the given type, or nil if it
+// is not present
+func getCondition(status *helmCrdV1.HelmReleaseStatus, condType helmCrdV1.HelmReleaseConditionType) *helmCrdV1.HelmReleaseCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == condType {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// setCondition adds or updates a condition. LastTransitionTime is
+// only changed when the condition status changes.
+func setCondition(status *helmCrdV1.HelmReleaseStatus, condType helmCrdV1.HelmReleaseConditionType, condStatus corev1.ConditionStatus, reason, message string) {
+	cond := getCondition(status, condType)
+	if cond == nil {
+		status.Conditions = append(status.Conditions, helmCrdV1.HelmReleaseCondition{Type: condType})
+		cond = &status.Conditions[len(status.Conditions)-1]
+	}
+	if cond.Status != condStatus {
+		cond.Status = condStatus
+		cond.LastTransitionTime = metav1.Now()
+	}
+	cond.Reason = reason
+	cond.Message = message
+}
+
+// setReconciling marks the release as being worked on at the given stage
+func setReconciling(status *helmCrdV1.HelmReleaseStatus, reason, message string) {
+	setCondition(status, helmCrdV1.HelmReleaseReconciling, corev1.ConditionTrue, reason, message)
+}
+
+// setFailed marks the release as failed because of err. The reason of
+// the conditions tells the stage that failed.
+func setFailed(status *helmCrdV1.HelmReleaseStatus, err error) {
+	reason := errorReason(err)
+	setCondition(status, helmCrdV1.HelmReleaseReady, corev1.ConditionFalse, reason, err.Error())
+	setCondition(status, helmCrdV1.HelmReleaseReconciling, corev1.ConditionFalse, reason, err.Error())
+	setCondition(status, helmCrdV1.HelmReleaseFailed, corev1.ConditionTrue, reason, err.Error())
+}
+
+// setReleaseStatusConditions sets the conditions of a release that has
+// been installed or upgraded according to its Tiller status
+func setReleaseStatusConditions(status *helmCrdV1.HelmReleaseStatus, rlsName string) {
+	if status.ReleaseStatus == release.Status_DEPLOYED.String() {
+		msg := fmt.Sprintf("Release %s is deployed at revision %d", rlsName, status.Revision)
+		setCondition(status, helmCrdV1.HelmReleaseReady, corev1.ConditionTrue, reasonReleaseDeployed, msg)
+		setCondition(status, helmCrdV1.HelmReleaseReconciling, corev1.ConditionFalse, reasonReleaseDeployed, msg)
+		setCondition(status, helmCrdV1.HelmReleaseFailed, corev1.ConditionFalse, reasonReleaseDeployed, msg)
+		return
+	}
+	msg := fmt.Sprintf("Release %s has status %s", rlsName, status.ReleaseStatus)
+	setCondition(status, helmCrdV1.HelmReleaseReady, corev1.ConditionFalse, reasonReleaseNotDeployed, msg)
+	setCondition(status, helmCrdV1.HelmReleaseReconciling, corev1.ConditionFalse, reasonReleaseNotDeployed, msg)
+	setCondition(status, helmCrdV1.HelmReleaseFailed, corev1.ConditionTrue, reasonReleaseNotDeployed, msg)
+}
+
+// keepTransitionTimes restores the LastTransitionTime of conditions
+// whose status is the same as in the previously persisted status, so
+// that transient transitions within a single reconcile are not
+// reported.
+func keepTransitionTimes(old, new *helmCrdV1.HelmReleaseStatus) {
+	for i := range new.Conditions {
+		cond := &new.Conditions[i]
+		if oldCond := getCondition(old, cond.Type); oldCond != nil && oldCond.Status == cond.Status {
+			cond.LastTransitionTime = oldCond.LastTransitionTime
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	helmCrdV1 "github.com/bitnami-labs/helm-crd/pkg/apis/helm.bitnami.com/v1"
+)
+
+func TestSetCondition(t *testing.T) {
+	status := helmCrdV1.HelmReleaseStatus{}
+	setCondition(&status, helmCrdV1.HelmReleaseReady, corev1.ConditionFalse, "Foo", "foo")
+	if len(status.Conditions) != 1 {
+		t.Fatalf("Expected one condition, received %v", status.Conditions)
+	}
+	transition := metav1.NewTime(status.Conditions[0].LastTransitionTime.Add(-1))
+	status.Conditions[0].LastTransitionTime = transition
+
+	// Same status only updates reason and message
+	setCondition(&status, helmCrdV1.HelmReleaseReady, corev1.ConditionFalse, "Bar", "bar")
+	cond := getCondition(&status, helmCrdV1.HelmReleaseReady)
+	if cond.Reason != "Bar" || cond.Message != "bar" {
+		t.Errorf("Expected reason Bar and message bar received %s and %s", cond.Reason, cond.Message)
+	}
+	if !cond.LastTransitionTime.Equal(&transition) {
+		t.Errorf("Unexpected transition time change")
+	}
+
+	// A status change is a transition
+	setCondition(&status, helmCrdV1.HelmReleaseReady, corev1.ConditionTrue, "Bar", "bar")
+	cond = getCondition(&status, helmCrdV1.HelmReleaseReady)
+	if cond.LastTransitionTime.Equal(&transition) {
+		t.Errorf("Expected transition time to change")
+	}
+	if len(status.Conditions) != 1 {
+		t.Errorf("Expected one condition, received %v", status.Conditions)
+	}
+}
+
+func TestErrorReason(t *testing.T) {
+	err := fmt.Errorf("boom")
+	if r := errorReason(err); r != reasonReconcileFailed {
+		t.Errorf("Expected reason %s received %s", reasonReconcileFailed, r)
+	}
+	if r := errorReason(withReason(reasonChartNotFound, err)); r != reasonChartNotFound {
+		t.Errorf("Expected reason %s received %s", reasonChartNotFound, r)
+	}
+	if withReason(reasonChartNotFound, nil) != nil {
+		t.Errorf("Expected nil error")
+	}
+}
@@ -1,60 +1,129 @@
 package main
 
 import (
+	"bytes"
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
+	"k8s.io/helm/pkg/chartutil"
 	"k8s.io/helm/pkg/helm"
+	"k8s.io/helm/pkg/proto/hapi/chart"
 	"k8s.io/helm/pkg/proto/hapi/release"
 
 	helmCrdV1 "github.com/bitnami-labs/helm-crd/pkg/apis/helm.bitnami.com/v1"
 	helmClientset "github.com/bitnami-labs/helm-crd/pkg/client/clientset/versioned"
+	helmScheme "github.com/bitnami-labs/helm-crd/pkg/client/clientset/versioned/scheme"
 	chartUtils "github.com/bitnami-labs/helm-crd/pkg/utils/chart"
 )
 
 const (
-	defaultNamespace      = metav1.NamespaceSystem
 	defaultRepoURL        = "https://kubernetes-charts.storage.googleapis.com"
 	releaseFinalizer      = "helm.bitnami.com/helmrelease"
+	controllerAgentName   = "helm-crd-controller"
 	defaultTimeoutSeconds = 180
 	maxRetries            = 5
+	maxRollbackHistory    = 32
+	failedUpgradeBackoff  = time.Hour
+	defaultIndexMaxAge    = 5 * time.Minute
+	defaultVersionPoll    = 10 * time.Minute
+	defaultWorkers        = 4
+	indexCacheLogPeriod   = 10 * time.Minute
 )
 
+// errStopping is returned by reconciles interrupted by the workers
+// stopping, and leaves the status of the HelmRelease unchanged
+var errStopping = fmt.Errorf("controller is stopping")
+
 // Controller is a cache.Controller for acting on Helm CRD objects
 type Controller struct {
 	queue             workqueue.RateLimitingInterface
 	informer          cache.SharedIndexInformer
+	configMapInformer cache.SharedIndexInformer
+	secretInformer    cache.SharedIndexInformer
+	// HelmRepositories and ClusterHelmRepositories, whose indexes are
+	// refreshed from repoQueue
+	repoQueue          workqueue.RateLimitingInterface
+	repositoryInformer cache.SharedIndexInformer
+	// clusterRepositoryInformer is nil when only some namespaces are
+	// watched
+	clusterRepositoryInformer cache.SharedIndexInformer
+	repoIndexes               repositoryIndexes
+	// defaultRepository is the ClusterHelmRepository used by
+	// HelmReleases without repoUrl nor repository
+	defaultRepository string
 	kubeClient        kubernetes.Interface
 	helmReleaseClient helmClientset.Interface
 	helmClient        helm.Interface
 	netClient         *chartUtils.HTTPClient
-	loadChart         chartUtils.LoadChart
+	indexCache        *chartUtils.IndexCache
+	// archiveCache stores downloaded charts, if not nil
+	archiveCache *chartUtils.ArchiveCache
+	// gitCache stores clones of the git repositories of charts. Git
+	// sources are disabled if nil.
+	gitCache *chartUtils.GitCache
+	// localChartDir is the directory file URLs are read from. File
+	// URLs are disabled if empty.
+	localChartDir string
+	// versionPollInterval is the interval between checks for newer
+	// versions of charts requested by a version range (0 to disable)
+	versionPollInterval time.Duration
+	// workers is the number of HelmReleases reconciled concurrently.
+	// The queue never hands the same HelmRelease to two workers.
+	workers int
+	// tillerOperations limits the number of install, upgrade and
+	// rollback calls to Tiller running at once, unlimited if nil
+	tillerOperations chan struct{}
+	// stopCh is closed when the workers stop, see runWorkers
+	stopCh <-chan struct{}
+	// processing holds the keys of the HelmReleases being reconciled,
+	// with the time their reconcile started
+	processing      map[string]time.Time
+	processingMutex sync.Mutex
+	loadChart       chartUtils.LoadChart
+	recorder        record.EventRecorder
+	secretAllowlist secretAllowlist
+	// newHTTPClient builds clients for repositories with custom TLS settings
+	newHTTPClient   func(*tls.Config) chartUtils.HTTPClient
+	tlsClients      map[string]*chartUtils.HTTPClient
+	tlsClientsMutex sync.Mutex
 }
 
-// NewController creates a Controller
-func NewController(clientset helmClientset.Interface, kubeClient kubernetes.Interface, helmClient helm.Interface, netClient chartUtils.HTTPClient, loadChart chartUtils.LoadChart) *Controller {
-	lw := cache.NewListWatchFromClient(clientset.HelmV1().RESTClient(), "helmreleases", metav1.NamespaceAll, fields.Everything())
-
-	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+// NewController creates a Controller of the objects selected by
+// watch. Every resyncPeriod all releases are checked for drift from
+// their HelmRelease spec.
+func NewController(clientset helmClientset.Interface, kubeClient kubernetes.Interface, helmClient helm.Interface, netClient chartUtils.HTTPClient, loadChart chartUtils.LoadChart, resyncPeriod time.Duration, watch watchOptions) *Controller {
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "helmreleases")
 
-	informer := cache.NewSharedIndexInformer(
-		lw,
+	informer := newInformer(
+		clientset.HelmV1().RESTClient(),
+		"helmreleases",
 		&helmCrdV1.HelmRelease{},
-		0, // No periodic resync
-		cache.Indexers{},
+		watch.namespaces,
+		watch.labelSelector,
+		resyncPeriod,
+		cache.Indexers{valuesFromIndex: valuesFromIndexFunc, repositoryIndex: repositoryIndexFunc},
 	)
 
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -69,7 +138,10 @@ func NewController(clientset helmClientset.Interface, kubeClient kubernetes.Inte
 			if err == nil {
 				newReleaseObj := newObj.(*helmCrdV1.HelmRelease)
 				oldReleaseObj := oldObj.(*helmCrdV1.HelmRelease)
-				if releaseObjChanged(oldReleaseObj, newReleaseObj) {
+				if oldReleaseObj.ResourceVersion == newReleaseObj.ResourceVersion {
+					// Periodic resync, check for drift
+					queue.Add(key)
+				} else if releaseObjChanged(oldReleaseObj, newReleaseObj) {
 					queue.Add(key)
 				} else {
 					log.Printf("Ignoring update event on unchanged object %v", newReleaseObj)
@@ -84,21 +156,58 @@ func NewController(clientset helmClientset.Interface, kubeClient kubernetes.Inte
 		},
 	})
 
-	return &Controller{
-		helmReleaseClient: clientset,
-		informer:          informer,
-		queue:             queue,
-		kubeClient:        kubeClient,
-		helmClient:        helmClient,
-		netClient:         &netClient,
-		loadChart:         loadChart,
+	// Register HelmRelease types so events can reference them
+	helmScheme.AddToScheme(scheme.Scheme)
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
+
+	// ConfigMaps and Secrets referenced in spec.valuesFrom
+	configMapInformer := newInformer(kubeClient.Core().RESTClient(), "configmaps", &corev1.ConfigMap{}, watch.namespaces, nil, 0, cache.Indexers{})
+	secretInformer := newInformer(kubeClient.Core().RESTClient(), "secrets", &corev1.Secret{}, watch.namespaces, nil, 0, cache.Indexers{})
+
+	repositoryInformer := newInformer(clientset.HelmV1().RESTClient(), "helmrepositories", &helmCrdV1.HelmRepository{}, watch.namespaces, nil, 0, cache.Indexers{})
+	var clusterRepositoryInformer cache.SharedIndexInformer
+	if watch.allNamespaces() {
+		clusterRepositoryInformer = newInformer(clientset.HelmV1().RESTClient(), "clusterhelmrepositories", &helmCrdV1.ClusterHelmRepository{}, nil, nil, 0, cache.Indexers{})
+	}
+
+	c := &Controller{
+		helmReleaseClient:         clientset,
+		informer:                  informer,
+		configMapInformer:         configMapInformer,
+		secretInformer:            secretInformer,
+		queue:                     queue,
+		repoQueue:                 workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "helmrepositories"),
+		repositoryInformer:        repositoryInformer,
+		clusterRepositoryInformer: clusterRepositoryInformer,
+		kubeClient:                kubeClient,
+		helmClient:                helmClient,
+		netClient:                 &netClient,
+		indexCache:                newIndexCache(defaultIndexMaxAge),
+		versionPollInterval:       defaultVersionPoll,
+		workers:                   defaultWorkers,
+		processing:                map[string]time.Time{},
+		loadChart:                 loadChart,
+		recorder:                  recorder,
+		newHTTPClient: func(config *tls.Config) chartUtils.HTTPClient {
+			return chartUtils.NewHTTPClient(time.Second*defaultTimeoutSeconds, config)
+		},
 	}
+	configMapInformer.AddEventHandler(c.valuesSourceHandler(configMapKind))
+	secretInformer.AddEventHandler(c.valuesSourceHandler(secretKind))
+	repositoryInformer.AddEventHandler(c.repositoryHandler(helmRepositoryKind))
+	if clusterRepositoryInformer != nil {
+		clusterRepositoryInformer.AddEventHandler(c.repositoryHandler(clusterHelmRepositoryKind))
+	}
+	return c
 }
 
 // HasSynced returns true once this controller has completed an
 // initial resource listing
 func (c *Controller) HasSynced() bool {
-	return c.informer.HasSynced()
+	return c.informer.HasSynced() && c.configMapInformer.HasSynced() && c.secretInformer.HasSynced() &&
+		c.repositoryInformer.HasSynced() && (c.clusterRepositoryInformer == nil || c.clusterRepositoryInformer.HasSynced())
 }
 
 // LastSyncResourceVersion is the resource version observed when last
@@ -118,8 +227,15 @@ func (c *Controller) Run(stopCh <-chan struct{}) {
 	defer utilruntime.HandleCrash()
 
 	defer c.queue.ShutDown()
+	defer c.repoQueue.ShutDown()
 
 	go c.informer.Run(stopCh)
+	go c.configMapInformer.Run(stopCh)
+	go c.secretInformer.Run(stopCh)
+	go c.repositoryInformer.Run(stopCh)
+	if c.clusterRepositoryInformer != nil {
+		go c.clusterRepositoryInformer.Run(stopCh)
+	}
 
 	// Set up a helm home dir sufficient to fool the rest of helm
 	// client code
@@ -134,14 +250,109 @@ func (c *Controller) Run(stopCh <-chan struct{}) {
 	}
 	log.Print("Cache synchronised, starting main loop")
 
-	wait.Until(c.runWorker, time.Second, stopCh)
+	go wait.Until(c.runRepositoryWorker, time.Second, stopCh)
+	go wait.Until(c.logIndexCacheStats, indexCacheLogPeriod, stopCh)
+	c.runWorkers(stopCh)
 
 	log.Print("Shutting down controller")
 }
 
-func (c *Controller) runWorker() {
-	for c.processNextItem() {
-		// continue looping
+// runWorkers processes the queue with c.workers workers until stopCh
+// is closed, then waits for the workers to finish the HelmRelease they
+// are reconciling. The rest of the queue is left unprocessed.
+func (c *Controller) runWorkers(stopCh <-chan struct{}) {
+	log.Printf("Starting %d workers", c.workers)
+	c.stopCh = stopCh
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait.Until(func() { c.runWorker(stopCh) }, time.Second, stopCh)
+		}()
+	}
+	<-stopCh
+	log.Print("Stopping workers")
+	c.queue.ShutDown()
+	wg.Wait()
+}
+
+// startTillerOperation waits until an install, upgrade or rollback of
+// helmObj can be sent to Tiller, and returns the function to call once
+// it is done. The time spent waiting for and in the Tiller call, which
+// spec.timeout bounds, doesn't count towards the reconcile time
+// checked by the liveness probe. It returns errStopping if the workers
+// stop in the meantime.
+func (c *Controller) startTillerOperation(helmObj *helmCrdV1.HelmRelease) (done func(), err error) {
+	key := helmObj.Namespace + "/" + helmObj.Name
+	c.processingMutex.Lock()
+	start, processing := c.processing[key]
+	delete(c.processing, key)
+	c.processingMutex.Unlock()
+
+	pauseStart := time.Now()
+	resume := func() {
+		if processing {
+			c.setProcessing(key, start.Add(time.Since(pauseStart)))
+		}
+	}
+	if c.tillerOperations == nil {
+		return resume, nil
+	}
+	select {
+	case c.tillerOperations <- struct{}{}:
+	case <-c.stopCh:
+		return nil, errStopping
+	}
+	return func() {
+		<-c.tillerOperations
+		resume()
+	}, nil
+}
+
+// setProcessing records that the HelmRelease with the given key is
+// being reconciled since start, or is no longer if start is zero
+func (c *Controller) setProcessing(key string, start time.Time) {
+	c.processingMutex.Lock()
+	defer c.processingMutex.Unlock()
+	if start.IsZero() {
+		delete(c.processing, key)
+	} else {
+		c.processing[key] = start
+	}
+}
+
+// oldestProcessing returns the key of the HelmRelease reconciled for
+// the longest time, with the time its reconcile started, or "" if no
+// HelmRelease is being reconciled
+func (c *Controller) oldestProcessing() (string, time.Time) {
+	c.processingMutex.Lock()
+	defer c.processingMutex.Unlock()
+	var oldestKey string
+	var oldest time.Time
+	for key, start := range c.processing {
+		if oldestKey == "" || start.Before(oldest) {
+			oldestKey, oldest = key, start
+		}
+	}
+	return oldestKey, oldest
+}
+
+func (c *Controller) logIndexCacheStats() {
+	stats := c.indexCache.Stats()
+	log.Printf("Repository index cache: %d hits, %d misses, %d revalidations, %d errors", stats.Hits, stats.Misses, stats.Revalidations, stats.Errors)
+}
+
+func (c *Controller) runWorker(stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+		if !c.processNextItem() {
+			return
+		}
 	}
 }
 
@@ -152,7 +363,16 @@ func (c *Controller) processNextItem() bool {
 	}
 
 	defer c.queue.Done(key)
+	start := time.Now()
+	c.setProcessing(key.(string), start)
 	err := c.updateRelease(key.(string))
+	c.setProcessing(key.(string), time.Time{})
+	if err == errStopping {
+		// Interrupted by the workers stopping, not failed
+		c.queue.Forget(key)
+		return true
+	}
+	observeReconcile(start, err)
 	if err == nil {
 		// No error, reset the ratelimit counters
 		c.queue.Forget(key)
@@ -162,6 +382,9 @@ func (c *Controller) processNextItem() bool {
 	} else {
 		// err != nil and too many retries
 		log.Printf("Error updating %s, giving up: %v", key, err)
+		if obj, exists, _ := c.informer.GetIndexer().GetByKey(key.(string)); exists {
+			c.recorder.Eventf(obj.(*helmCrdV1.HelmRelease), corev1.EventTypeWarning, reasonRetriesExhausted, "Giving up after %d retries: %v", maxRetries, err)
+		}
 		c.queue.Forget(key)
 		utilruntime.HandleError(err)
 	}
@@ -243,9 +466,12 @@ func addFinalizer(helmObj *helmCrdV1.HelmRelease) *helmCrdV1.HelmRelease {
 	return helmObjClone
 }
 
-func updateHelmRelease(helmReleaseClient helmClientset.Interface, helmObj *helmCrdV1.HelmRelease) error {
-	_, err := helmReleaseClient.HelmV1().HelmReleases(helmObj.Namespace).Update(helmObj)
-	return err
+func updateHelmRelease(helmReleaseClient helmClientset.Interface, helmObj *helmCrdV1.HelmRelease) (*helmCrdV1.HelmRelease, error) {
+	return helmReleaseClient.HelmV1().HelmReleases(helmObj.Namespace).Update(helmObj)
+}
+
+func updateHelmReleaseStatus(helmReleaseClient helmClientset.Interface, helmObj *helmCrdV1.HelmRelease) (*helmCrdV1.HelmRelease, error) {
+	return helmReleaseClient.HelmV1().HelmReleases(helmObj.Namespace).UpdateStatus(helmObj)
 }
 
 func (c *Controller) updateRelease(key string) error {
@@ -257,6 +483,7 @@ func (c *Controller) updateRelease(key string) error {
 	// this is an update when Function API object is actually deleted, we dont need to process anything here
 	if !exists {
 		log.Printf("HelmRelease object %s not found in the cache, ignoring the deletion update", key)
+		deleteReleaseStatusMetric(key)
 		return nil
 	}
 
@@ -268,14 +495,17 @@ func (c *Controller) updateRelease(key string) error {
 		if !hasFinalizer(helmObj) {
 			return nil
 		}
-		_, err = c.helmClient.DeleteRelease(getReleaseName(helmObj), helm.DeletePurge(true))
+		_, err = c.helmClient.DeleteRelease(getReleaseName(helmObj), deleteOptions(helmObj)...)
 		if err != nil {
+			c.recorder.Eventf(helmObj, corev1.EventTypeWarning, reasonDeleteFailed, "Failed to delete release %s: %v", getReleaseName(helmObj), err)
 			return err
 		}
+		c.recorder.Eventf(helmObj, corev1.EventTypeNormal, reasonDeleted, "Deleted release %s", getReleaseName(helmObj))
+		deleteReleaseStatusMetric(key)
 
 		// remove finalizer from the function object, so that we dont have to process any further and object can be deleted
 		helmObjCopy := removeFinalizer(helmObj)
-		err = updateHelmRelease(c.helmReleaseClient, helmObjCopy)
+		_, err = updateHelmRelease(c.helmReleaseClient, helmObjCopy)
 		if err != nil {
 			log.Printf("Failed to remove finalizer for obj: %s object due to: %v: ", key, err)
 			return err
@@ -285,94 +515,636 @@ func (c *Controller) updateRelease(key string) error {
 	}
 
 	if !hasFinalizer(helmObj) {
-		helmObjCopy := addFinalizer(helmObj)
-		err = updateHelmRelease(c.helmReleaseClient, helmObjCopy)
+		helmObj, err = updateHelmRelease(c.helmReleaseClient, addFinalizer(helmObj))
 		if err != nil {
 			log.Printf("Error adding finalizer to %s due to: %v: ", key, err)
 			return err
 		}
 	}
 
-	repoURL := helmObj.Spec.RepoURL
-	if repoURL == "" {
-		// FIXME: Make configurable
-		repoURL = defaultRepoURL
+	helmObjCopy := helmObj.DeepCopy()
+	helmObjCopy.Status.LastError = ""
+	err = c.syncRelease(helmObjCopy)
+	if err == errStopping {
+		return err
 	}
-	repoURL = strings.TrimSuffix(strings.TrimSpace(repoURL), "/") + "/index.yaml"
 
-	authHeader := ""
-	if helmObj.Spec.Auth.Header != nil {
-		namespace := os.Getenv("POD_NAMESPACE")
-		if namespace == "" {
-			namespace = defaultNamespace
+	helmObjCopy.Status.ObservedGeneration = helmObj.Generation
+	if err != nil {
+		helmObjCopy.Status.LastError = err.Error()
+		setFailed(&helmObjCopy.Status, err)
+		c.recorder.Event(helmObj, corev1.EventTypeWarning, errorReason(err), err.Error())
+	}
+	keepTransitionTimes(&helmObj.Status, &helmObjCopy.Status)
+	if !apiequality.Semantic.DeepEqual(helmObj.Status, helmObjCopy.Status) {
+		if _, statusErr := updateHelmReleaseStatus(c.helmReleaseClient, helmObjCopy); statusErr != nil {
+			log.Printf("Error updating status of %s due to: %v", key, statusErr)
+			if err == nil {
+				err = statusErr
+			}
 		}
+	}
 
-		secret, err := c.kubeClient.Core().Secrets(namespace).Get(helmObj.Spec.Auth.Header.SecretKeyRef.Name, metav1.GetOptions{})
-		if err != nil {
-			return err
-		}
-		authHeader = string(secret.Data[helmObj.Spec.Auth.Header.SecretKeyRef.Key])
+	if err == nil && c.versionPollInterval > 0 && hasVersionRange(helmObj) {
+		// Check for newer versions
+		c.queue.AddAfter(key, c.versionPollInterval)
 	}
 
-	log.Printf("Downloading repo %s index...", repoURL)
-	repoIndex, err := chartUtils.FetchRepoIndex(c.netClient, repoURL, authHeader)
-	if err != nil {
-		return err
+	return err
+}
+
+// syncRelease installs or upgrades the Tiller release described by
+// helmObj, recording the outcome in helmObj.Status.
+func (c *Controller) syncRelease(helmObj *helmCrdV1.HelmRelease) error {
+	if helmObj.Spec.Rollback != nil {
+		return c.rollbackRelease(helmObj)
 	}
 
-	chartURL, err := chartUtils.FindChartInRepoIndex(repoIndex, repoURL, helmObj.Spec.ChartName, helmObj.Spec.Version)
+	values, err := c.releaseValues(helmObj)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("Downloading %s ...", chartURL)
-	chartRequested, err := chartUtils.FetchChart(c.netClient, chartURL, authHeader, c.loadChart)
+	rlsName := getReleaseName(helmObj)
+	if isSynced(helmObj) {
+		drift := c.detectDrift(helmObj, rlsName, values)
+		if drift == "" {
+			helmObj.Status.Drift = ""
+			newVersion := c.newChartVersion(helmObj)
+			if newVersion == "" {
+				log.Printf("Release %s is up to date", rlsName)
+				return nil
+			}
+			log.Printf("Release %s can be upgraded: %s", rlsName, newVersion)
+			c.recorder.Eventf(helmObj, corev1.EventTypeNormal, reasonNewChartVersion, "Upgrading release %s: %s", rlsName, newVersion)
+		} else {
+			log.Printf("Release %s drifted from its spec: %s", rlsName, drift)
+			helmObj.Status.Drift = drift
+			c.recorder.Eventf(helmObj, corev1.EventTypeWarning, reasonDriftDetected, "Release %s drifted from its spec: %s", rlsName, drift)
+		}
+	}
+
+	var chartRequested *chart.Chart
+	var chartURL, commit string
+	if git := gitSource(helmObj); git != nil {
+		chartRequested, chartURL, commit, err = c.fetchGitChart(helmObj, git)
+	} else if helmObj.Spec.ChartURL != "" {
+		chartRequested, chartURL, err = c.fetchURLChart(helmObj)
+	} else {
+		chartRequested, chartURL, err = c.fetchRepositoryChart(helmObj)
+	}
 	if err != nil {
 		return err
 	}
 
-	rlsName := getReleaseName(helmObj)
 	var rel *release.Release
+	upgraded := false
 
 	h, err := c.helmClient.ReleaseHistory(rlsName, helm.WithMaxHistory(1))
 	if err != nil || len(h.GetReleases()) == 0 {
 		if err != nil && !isNotFound(err) {
-			return err
+			return withReason(reasonReleaseHistoryFailed, err)
 		}
 		log.Printf("Installing release %s into namespace %s", rlsName, helmObj.Namespace)
-		res, err := c.helmClient.InstallReleaseFromChart(
-			chartRequested,
-			helmObj.Namespace,
-			helm.ValueOverrides([]byte(helmObj.Spec.Values)),
-			helm.ReleaseName(rlsName),
-		)
+		setReconciling(&helmObj.Status, reasonInstalling, fmt.Sprintf("Installing release %s", rlsName))
+		c.recorder.Eventf(helmObj, corev1.EventTypeNormal, reasonInstalling, "Installing release %s of chart %s", rlsName, chartURL)
+		done, err := c.startTillerOperation(helmObj)
 		if err != nil {
 			return err
 		}
+		res, err := c.helmClient.InstallReleaseFromChart(chartRequested, helmObj.Namespace, installOptions(helmObj, rlsName, values)...)
+		done()
+		if err != nil {
+			return withReason(reasonInstallFailed, err)
+		}
 		rel = res.GetRelease()
+		c.recorder.Eventf(helmObj, corev1.EventTypeNormal, reasonInstalled, "Installed release %s", rlsName)
 	} else {
-		log.Printf("Updating release %s", rlsName)
-		res, err := c.helmClient.UpdateReleaseFromChart(
-			rlsName,
-			chartRequested,
-			helm.UpdateValueOverrides([]byte(helmObj.Spec.Values)),
-			//helm.UpgradeForce(true), ?
-		)
+		deployed, err := c.helmClient.ReleaseContent(rlsName)
 		if err != nil {
-			return err
+			log.Printf("Unable to fetch deployed release %s, upgrading: %v", rlsName, err)
 		}
-		rel = res.GetRelease()
+		if err == nil && !upgradeNeeded(deployed.GetRelease(), chartRequested, values) {
+			log.Printf("Release %s is up to date, skipping upgrade", rlsName)
+			rel = deployed.GetRelease()
+			helmObj.Status.Drift = ""
+		} else if f := helmObj.Status.FailedUpgrade; upgradeBackingOff(helmObj, chartRequested.GetMetadata().GetVersion(), commit) {
+			log.Printf("Upgrade of release %s failed at %s, not retrying before %s", rlsName, f.Time, f.Time.Add(failedUpgradeBackoff))
+			helmObj.Status.LastError = f.Error
+			return nil
+		} else {
+			log.Printf("Updating release %s", rlsName)
+			setReconciling(&helmObj.Status, reasonUpgrading, fmt.Sprintf("Upgrading release %s", rlsName))
+			c.recorder.Eventf(helmObj, corev1.EventTypeNormal, reasonUpgrading, "Upgrading release %s to chart %s", rlsName, chartURL)
+			done, err := c.startTillerOperation(helmObj)
+			if err != nil {
+				return err
+			}
+			res, err := c.helmClient.UpdateReleaseFromChart(rlsName, chartRequested, upgradeOptions(helmObj, values)...)
+			done()
+			if err != nil {
+				if helmObj.Spec.Upgrade.RollbackOnFailure {
+					return c.rollbackFailedUpgrade(helmObj, rlsName, chartRequested.GetMetadata().GetVersion(), commit, err)
+				}
+				return withReason(reasonUpgradeFailed, err)
+			}
+			rel = res.GetRelease()
+			c.recorder.Eventf(helmObj, corev1.EventTypeNormal, reasonUpgraded, "Upgraded release %s", rlsName)
+			upgraded = true
+		}
+	}
+
+	helmObj.Status.ChartVersion = chartRequested.GetMetadata().GetVersion()
+	helmObj.Status.GitCommit = commit
+	helmObj.Status.Source = chartURL
+	c.checkReleaseStatus(helmObj, rlsName, rel)
+
+	if upgraded && helmObj.Spec.Upgrade.RollbackOnFailure && helmObj.Status.ReleaseStatus == release.Status_FAILED.String() {
+		return c.rollbackFailedUpgrade(helmObj, rlsName, helmObj.Status.ChartVersion, commit, fmt.Errorf("release %s failed after upgrade", rlsName))
 	}
+	helmObj.Status.RollbackRevision = 0
+	helmObj.Status.FailedUpgrade = nil
+
+	return nil
+}
 
-	status, err := c.helmClient.ReleaseStatus(rel.Name)
+// chartRepositoryClient returns the repository of the chart requested
+// by helmObj, with the HTTP client, its TLS identity and the
+// Authorization header to use
+func (c *Controller) chartRepositoryClient(helmObj *helmCrdV1.HelmRelease) (*chartRepository, *chartUtils.HTTPClient, string, string, error) {
+	repository, err := c.chartRepository(helmObj)
+	if err != nil {
+		return nil, nil, "", "", err
+	}
+	authHeader, err := c.authHeader(repository.namespace, repository.auth)
+	if err != nil {
+		return nil, nil, "", "", err
+	}
+	netClient, tlsIdentity, err := c.httpClient(repository.namespace, repository.auth)
+	if err != nil {
+		return nil, nil, "", "", err
+	}
+	return repository, netClient, tlsIdentity, authHeader, nil
+}
+
+// ociChartRef returns the reference of the chart requested by helmObj
+// if it is stored in an OCI registry, or nil. The credentials of a
+// HelmRepository or ClusterHelmRepository are only sent to its own
+// registry: a chartRef on another host is rejected.
+func ociChartRef(helmObj *helmCrdV1.HelmRelease, repository *chartRepository) (*chartUtils.OCIReference, error) {
+	chartRef := helmObj.Spec.ChartRef
+	if chartRef == "" {
+		if !chartUtils.IsOCI(repository.url) {
+			return nil, nil
+		}
+		chartRef = strings.TrimSuffix(strings.TrimSpace(repository.url), "/") + "/" + helmObj.Spec.ChartName
+	}
+	ref, err := chartUtils.ParseOCIReference(chartRef)
+	if err != nil {
+		return nil, withReason(reasonChartNotFound, err)
+	}
+	if repository.key != "" {
+		repoURL, err := url.Parse(strings.TrimSpace(repository.url))
+		if err != nil || !strings.EqualFold(repoURL.Host, ref.Registry) {
+			return nil, withReason(reasonRepositoryNotFound, fmt.Errorf("chartRef %s is not in the registry of %s", ref, repository.key))
+		}
+	}
+	return ref, nil
+}
+
+// hasVersionRange returns true if the chart version requested by
+// helmObj is resolved from a range, or from a git branch, so that the
+// release can be upgraded without any change to its spec. An empty
+// version isn't a range: the newest version is only installed once,
+// following it (across major versions) requires "*".
+func hasVersionRange(helmObj *helmCrdV1.HelmRelease) bool {
+	if helmObj.Spec.Rollback != nil {
+		return false
+	}
+	if git := gitSource(helmObj); git != nil {
+		return !chartUtils.IsGitCommit(git.Ref)
+	}
+	if helmObj.Spec.ChartURL != "" {
+		return false
+	}
+	if version := strings.TrimSpace(helmObj.Spec.Version); version == "" || !chartUtils.IsVersionConstraint(version) {
+		return false
+	}
+	if helmObj.Spec.ChartRef != "" {
+		ref, err := chartUtils.ParseOCIReference(helmObj.Spec.ChartRef)
+		return err == nil && ref.Tag == "" && ref.Digest == ""
+	}
+	return true
+}
+
+// newChartVersion describes the chart helmObj would be upgraded to:
+// the newest chart version matching its version range, or the latest
+// commit of its git branch. It returns "" if that is the deployed
+// chart. Errors are only logged, as the deployed release is still up
+// to date with its spec.
+func (c *Controller) newChartVersion(helmObj *helmCrdV1.HelmRelease) string {
+	if c.versionPollInterval <= 0 || !hasVersionRange(helmObj) {
+		return ""
+	}
+	if git := gitSource(helmObj); git != nil {
+		commit, err := c.resolveGitCommit(helmObj, git)
+		if err != nil {
+			log.Printf("Unable to check for new commits of %s: %v", git.URL, err)
+			return ""
+		}
+		if commit == helmObj.Status.GitCommit {
+			return ""
+		}
+		return fmt.Sprintf("commit %s of %s is not deployed", commit, gitRefName(git))
+	}
+
+	version, err := c.resolveChartVersion(helmObj)
+	if err != nil {
+		log.Printf("Unable to check for new versions of chart %s: %v", chartName(helmObj), err)
+		return ""
+	}
+	if version == helmObj.Status.ChartVersion {
+		return ""
+	}
+	return fmt.Sprintf("chart version %s matches %q, deployed version is %s", version, helmObj.Spec.Version, helmObj.Status.ChartVersion)
+}
+
+// resolveChartVersion returns the newest chart version matching the
+// version range of helmObj, without downloading the chart
+func (c *Controller) resolveChartVersion(helmObj *helmCrdV1.HelmRelease) (string, error) {
+	repository, netClient, tlsIdentity, authHeader, err := c.chartRepositoryClient(helmObj)
+	if err != nil {
+		return "", err
+	}
+	ref, err := ociChartRef(helmObj, repository)
+	if err != nil {
+		return "", err
+	}
+	if ref != nil {
+		ref, err = chartUtils.ResolveOCIReference(netClient, ref, helmObj.Spec.Version, helmObj.Spec.Prereleases, authHeader)
+		if err != nil {
+			return "", err
+		}
+		return strings.Replace(ref.Tag, "_", "+", -1), nil
+	}
+
+	repoIndex, _, err := c.repositoryIndex(repository, c.getters(netClient), authHeader, tlsIdentity)
+	if err != nil {
+		return "", err
+	}
+	cv, err := chartUtils.FindChartVersionInRepoIndex(repoIndex, helmObj.Spec.ChartName, helmObj.Spec.Version, helmObj.Spec.Prereleases)
+	if err != nil {
+		return "", err
+	}
+	return cv.Version, nil
+}
+
+// fetchRepositoryChart downloads the chart requested by helmObj,
+// either from an OCI registry or from a chart repository. It also
+// returns the URL the chart was fetched from.
+func (c *Controller) fetchRepositoryChart(helmObj *helmCrdV1.HelmRelease) (*chart.Chart, string, error) {
+	repository, netClient, tlsIdentity, authHeader, err := c.chartRepositoryClient(helmObj)
+	if err != nil {
+		return nil, "", err
+	}
+	ref, err := ociChartRef(helmObj, repository)
+	if err != nil {
+		return nil, "", err
+	}
+	if ref != nil {
+		if helmObj.Spec.Verify != nil {
+			return nil, "", withReason(reasonVerificationFailed, fmt.Errorf("provenance verification is not supported for OCI charts"))
+		}
+		setReconciling(&helmObj.Status, reasonFetchingChart, fmt.Sprintf("Fetching chart %s", ref))
+		ref, err = chartUtils.ResolveOCIReference(netClient, ref, helmObj.Spec.Version, helmObj.Spec.Prereleases, authHeader)
+		if err != nil {
+			return nil, "", withReason(reasonChartNotFound, err)
+		}
+		log.Printf("Downloading %s ...", ref)
+		start := time.Now()
+		chartRequested, err := chartUtils.FetchOCIChart(netClient, ref, authHeader, c.loadChart)
+		observeDownload(downloadChart, ref.Registry, time.Since(start), err)
+		if err != nil {
+			return nil, "", withReason(reasonChartFetchFailed, err)
+		}
+		return chartRequested, ref.String(), nil
+	}
+
+	setReconciling(&helmObj.Status, reasonFetchingRepoIndex, fmt.Sprintf("Fetching repository index %s", indexURL(repository.url)))
+	getters := c.getters(netClient)
+	repoIndex, repoURL, err := c.repositoryIndex(repository, getters, authHeader, tlsIdentity)
+	if err != nil {
+		return nil, "", withReason(reasonRepoIndexFetchFailed, err)
+	}
+
+	cv, err := chartUtils.FindChartVersionInRepoIndex(repoIndex, helmObj.Spec.ChartName, helmObj.Spec.Version, helmObj.Spec.Prereleases)
+	if err != nil {
+		return nil, "", withReason(reasonChartNotFound, err)
+	}
+	chartURLs, err := chartUtils.ChartVersionURLs(cv, repoURL)
+	if err != nil {
+		return nil, "", withReason(reasonChartNotFound, err)
+	}
+
+	// The URLs of the chart are tried in order, but an archive failing
+	// verification is an error rather than a reason to try the next one
+	var errs []string
+	for _, chartURL := range chartURLs {
+		chartRequested, err := c.downloadChart(helmObj, getters, repoURL, chartURL, cv.Digest, authHeader, tlsIdentity)
+		if err == nil {
+			return chartRequested, chartURL, nil
+		}
+		if errorReason(err) == reasonVerificationFailed || len(chartURLs) == 1 {
+			return nil, "", err
+		}
+		log.Printf("Unable to download %s: %v", chartURL, err)
+		errs = append(errs, err.Error())
+	}
+	return nil, "", withReason(reasonChartFetchFailed, fmt.Errorf("%s", strings.Join(errs, "; ")))
+}
+
+// fetchURLChart downloads the chart archive at spec.chartUrl, with
+// the credentials in spec.auth
+func (c *Controller) fetchURLChart(helmObj *helmCrdV1.HelmRelease) (*chart.Chart, string, error) {
+	authHeader, err := c.authHeader(helmObj.Namespace, &helmObj.Spec.Auth)
+	if err != nil {
+		return nil, "", err
+	}
+	netClient, _, err := c.httpClient(helmObj.Namespace, &helmObj.Spec.Auth)
+	if err != nil {
+		return nil, "", err
+	}
+	chartURL := strings.TrimSpace(helmObj.Spec.ChartURL)
+	// The archive at a URL may be replaced, so it isn't cached
+	chartRequested, err := c.downloadChart(helmObj, c.getters(netClient), "", chartURL, "", authHeader, "")
+	if err != nil {
+		return nil, "", err
+	}
+	return chartRequested, chartURL, nil
+}
+
+// downloadChart downloads the chart archive at chartURL, from the
+// archive cache if enabled and the chart is in the repository at
+// repoURL (not empty), and loads it once it has been checked against
+// digest and spec.verify. tlsIdentity identifies the TLS settings of
+// getter, see httpClient.
+func (c *Controller) downloadChart(helmObj *helmCrdV1.HelmRelease, getter chartUtils.Getter, repoURL, chartURL, digest, authHeader, tlsIdentity string) (*chart.Chart, error) {
+	log.Printf("Downloading %s ...", chartURL)
+	setReconciling(&helmObj.Status, reasonFetchingChart, fmt.Sprintf("Fetching chart %s", chartURL))
+	getter = metricsGetter{getter}
+	var archive []byte
+	var err error
+	if repoURL != "" && c.archiveCache != nil {
+		archive, err = c.archiveCache.FetchChartArchive(getter, repoURL, chartURL, digest, authHeader, tlsIdentity)
+	} else {
+		archive, err = chartUtils.FetchChartArchive(getter, chartURL, digest, authHeader)
+	}
+	if err != nil {
+		if chartUtils.IsVerificationError(err) {
+			return nil, withReason(reasonVerificationFailed, err)
+		}
+		return nil, withReason(reasonChartFetchFailed, err)
+	}
+	if helmObj.Spec.Verify != nil {
+		if err := c.verifyProvenance(helmObj, getter, chartURL, authHeader, archive); err != nil {
+			return nil, err
+		}
+	}
+	chartRequested, err := c.loadChart(bytes.NewReader(archive))
+	if err != nil {
+		return nil, withReason(reasonChartFetchFailed, err)
+	}
+	return chartRequested, nil
+}
+
+// getters returns the Getters of chart repositories accessed with
+// netClient
+func (c *Controller) getters(netClient *chartUtils.HTTPClient) chartUtils.Getters {
+	return chartUtils.NewGetters(netClient, c.localChartDir)
+}
+
+// chartName returns the name of the chart requested by helmObj
+func chartName(helmObj *helmCrdV1.HelmRelease) string {
+	if helmObj.Spec.ChartRef != "" {
+		if ref, err := chartUtils.ParseOCIReference(helmObj.Spec.ChartRef); err == nil {
+			return ref.ChartName()
+		}
+	}
+	return helmObj.Spec.ChartName
+}
+
+// isSynced returns true if the release was successfully reconciled
+// with the current spec, so any difference with the deployed release
+// is drift rather than a pending change.
+func isSynced(helmObj *helmCrdV1.HelmRelease) bool {
+	ready := getCondition(&helmObj.Status, helmCrdV1.HelmReleaseReady)
+	return helmObj.Status.ObservedGeneration == helmObj.Generation &&
+		ready != nil && ready.Status == corev1.ConditionTrue
+}
+
+// detectDrift compares the release deployed in Tiller against the
+// spec, returning a description of the first difference found or ""
+// if the release is in sync. Errors are reported as drift, so that
+// the release is reconciled in full.
+func (c *Controller) detectDrift(helmObj *helmCrdV1.HelmRelease, rlsName, values string) string {
+	res, err := c.helmClient.ReleaseContent(rlsName)
+	if err != nil {
+		return fmt.Sprintf("unable to fetch release: %v", err)
+	}
+	return releaseDrift(helmObj, res.GetRelease(), values)
+}
+
+func releaseDrift(helmObj *helmCrdV1.HelmRelease, rel *release.Release, values string) string {
+	meta := rel.GetChart().GetMetadata()
+	if name := chartName(helmObj); name != "" && meta.GetName() != name {
+		return fmt.Sprintf("chart is %q instead of %q", meta.GetName(), name)
+	}
+	version := helmObj.Spec.Version
+	if chartUtils.IsVersionConstraint(version) {
+		// Resolved when installed or upgraded
+		version = helmObj.Status.ChartVersion
+	}
+	if meta.GetVersion() != version {
+		return fmt.Sprintf("chart version is %q instead of %q", meta.GetVersion(), version)
+	}
+	// Tiller merges reused values into the deployed config
+	if !helmObj.Spec.Upgrade.ReuseValues && !valuesEqual(rel.GetConfig().GetRaw(), values) {
+		return "values differ"
+	}
+	if code := rel.GetInfo().GetStatus().GetCode(); code != release.Status_DEPLOYED {
+		return fmt.Sprintf("release status is %s", code)
+	}
+	if rel.GetVersion() != helmObj.Status.Revision {
+		return fmt.Sprintf("release revision is %d instead of %d", rel.GetVersion(), helmObj.Status.Revision)
+	}
+	return ""
+}
+
+// valuesEqual returns true if the deployed and desired values have the
+// same meaning, regardless of comments, formatting or key order.
+// Values that can't be parsed are never equal.
+func valuesEqual(deployed, desired string) bool {
+	deployedValues, err := chartutil.ReadValues([]byte(deployed))
+	if err != nil {
+		return false
+	}
+	desiredValues, err := chartutil.ReadValues([]byte(desired))
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(deployedValues, desiredValues)
+}
+
+// upgradeNeeded returns false if the deployed release already runs the
+// requested chart with the same values, in which case an upgrade would
+// only add an identical revision to the release history.
+func upgradeNeeded(deployed *release.Release, requested *chart.Chart, values string) bool {
+	if deployed.GetInfo().GetStatus().GetCode() != release.Status_DEPLOYED {
+		return true
+	}
+	if !proto.Equal(deployed.GetChart().GetMetadata(), requested.GetMetadata()) {
+		return true
+	}
+	return !valuesEqual(deployed.GetConfig().GetRaw(), values)
+}
+
+// checkReleaseStatus records the Tiller status of the release after
+// rel has been installed, upgraded or rolled back
+func (c *Controller) checkReleaseStatus(helmObj *helmCrdV1.HelmRelease, rlsName string, rel *release.Release) {
+	if rel != nil {
+		helmObj.Status.Revision = rel.GetVersion()
+	}
+
+	setReconciling(&helmObj.Status, reasonCheckingStatus, fmt.Sprintf("Checking status of release %s", rlsName))
+	status, err := c.helmClient.ReleaseStatus(rlsName)
 	if err == nil {
-		log.Printf("Installed/updated release %s", rel.Name)
+		log.Printf("Installed/updated release %s", rlsName)
 		if status.Info != nil && status.Info.Status != nil {
 			log.Printf("Release status: %s", status.Info.Status.Code)
+			helmObj.Status.ReleaseStatus = status.Info.Status.Code.String()
+			setReleaseStatusMetric(helmObj, status.Info.Status.Code)
 		}
+		setReleaseStatusConditions(&helmObj.Status, rlsName)
 	} else {
-		log.Printf("Unable to fetch release status for %s: %v", rel.Name, err)
+		log.Printf("Unable to fetch release status for %s: %v", rlsName, err)
+		msg := fmt.Sprintf("Unable to fetch status of release %s: %v", rlsName, err)
+		setCondition(&helmObj.Status, helmCrdV1.HelmReleaseReady, corev1.ConditionUnknown, reasonReleaseStatusFailed, msg)
+		setCondition(&helmObj.Status, helmCrdV1.HelmReleaseReconciling, corev1.ConditionFalse, reasonReleaseStatusFailed, msg)
+		setCondition(&helmObj.Status, helmCrdV1.HelmReleaseFailed, corev1.ConditionFalse, reasonReleaseStatusFailed, msg)
+	}
+}
+
+// rollbackRelease rolls the release back to the revision pinned in
+// spec.rollback, unless that was already done
+func (c *Controller) rollbackRelease(helmObj *helmCrdV1.HelmRelease) error {
+	rlsName := getReleaseName(helmObj)
+	rb := helmObj.Spec.Rollback
+	if helmObj.Status.RollbackRevision == rb.Revision {
+		log.Printf("Release %s already rolled back to revision %d", rlsName, rb.Revision)
+		return nil
 	}
 
+	log.Printf("Rolling back release %s to revision %d", rlsName, rb.Revision)
+	setReconciling(&helmObj.Status, reasonRollingBack, fmt.Sprintf("Rolling back release %s to revision %d", rlsName, rb.Revision))
+	done, err := c.startTillerOperation(helmObj)
+	if err != nil {
+		return err
+	}
+	res, err := c.helmClient.RollbackRelease(rlsName, rollbackOptions(helmObj, rb.Revision)...)
+	done()
+	if err != nil {
+		return withReason(reasonRollbackFailed, err)
+	}
+	c.recorder.Eventf(helmObj, corev1.EventTypeNormal, reasonRolledBack, "Rolled back release %s to revision %d", rlsName, rb.Revision)
+
+	helmObj.Status.RollbackRevision = rb.Revision
+	if v := res.GetRelease().GetChart().GetMetadata().GetVersion(); v != "" {
+		helmObj.Status.ChartVersion = v
+	}
+	c.checkReleaseStatus(helmObj, rlsName, res.GetRelease())
+	return nil
+}
+
+// rollbackFailedUpgrade rolls the release back to its last good
+// revision after the upgrade to chartVersion (checked out from commit
+// for git sources) failed with upgradeErr. The failure is recorded in
+// the status but not returned, and the same upgrade is not retried
+// until the spec changes or failedUpgradeBackoff passes.
+func (c *Controller) rollbackFailedUpgrade(helmObj *helmCrdV1.HelmRelease, rlsName, chartVersion, commit string, upgradeErr error) error {
+	h, err := c.helmClient.ReleaseHistory(rlsName, helm.WithMaxHistory(maxRollbackHistory))
+	if err != nil {
+		return withReason(reasonReleaseHistoryFailed, err)
+	}
+	revision := lastGoodRevision(h.GetReleases())
+	if revision == 0 {
+		log.Printf("Upgrade of release %s failed, no revision to roll back to", rlsName)
+		return withReason(reasonUpgradeFailed, upgradeErr)
+	}
+
+	log.Printf("Upgrade of release %s failed, rolling back to revision %d: %v", rlsName, revision, upgradeErr)
+	setReconciling(&helmObj.Status, reasonRollingBack, fmt.Sprintf("Rolling back release %s to revision %d", rlsName, revision))
+	done, err := c.startTillerOperation(helmObj)
+	if err != nil {
+		return err
+	}
+	res, err := c.helmClient.RollbackRelease(rlsName, rollbackOptions(helmObj, revision)...)
+	done()
+	if err != nil {
+		return withReason(reasonRollbackFailed, fmt.Errorf("upgrade failed: %v, rollback to revision %d failed: %v", upgradeErr, revision, err))
+	}
+	c.recorder.Eventf(helmObj, corev1.EventTypeWarning, reasonRolledBack, "Upgrade of release %s failed, rolled back to revision %d: %v", rlsName, revision, upgradeErr)
+
+	helmObj.Status.RollbackRevision = revision
+	if v := res.GetRelease().GetChart().GetMetadata().GetVersion(); v != "" {
+		helmObj.Status.ChartVersion = v
+	}
+	c.checkReleaseStatus(helmObj, rlsName, res.GetRelease())
+
+	msg := fmt.Sprintf("Upgrade failed, rolled back to revision %d: %v", revision, upgradeErr)
+	helmObj.Status.LastError = upgradeErr.Error()
+	helmObj.Status.FailedUpgrade = &helmCrdV1.HelmReleaseFailedUpgrade{
+		Generation:   helmObj.Generation,
+		ChartVersion: chartVersion,
+		GitCommit:    commit,
+		Error:        upgradeErr.Error(),
+		Time:         metav1.Now(),
+	}
+	setCondition(&helmObj.Status, helmCrdV1.HelmReleaseReady, corev1.ConditionFalse, reasonRolledBack, msg)
+	setCondition(&helmObj.Status, helmCrdV1.HelmReleaseReconciling, corev1.ConditionFalse, reasonRolledBack, msg)
+	setCondition(&helmObj.Status, helmCrdV1.HelmReleaseFailed, corev1.ConditionTrue, reasonRolledBack, msg)
 	return nil
 }
+
+// upgradeBackingOff returns true if the upgrade of helmObj to
+// chartVersion (checked out from commit for git sources) already failed
+// and was rolled back, less than failedUpgradeBackoff ago and for the
+// same spec
+func upgradeBackingOff(helmObj *helmCrdV1.HelmRelease, chartVersion, commit string) bool {
+	f := helmObj.Status.FailedUpgrade
+	return f != nil && helmObj.Spec.Upgrade.RollbackOnFailure &&
+		f.Generation == helmObj.Generation &&
+		f.ChartVersion == chartVersion &&
+		f.GitCommit == commit &&
+		time.Since(f.Time.Time) < failedUpgradeBackoff
+}
+
+// lastGoodRevision returns the most recent revision that can be rolled
+// back to after a failed upgrade, or 0 if there is none. There is
+// nothing to roll back if the latest revision is still deployed.
+func lastGoodRevision(history []*release.Release) int32 {
+	rels := make([]*release.Release, len(history))
+	copy(rels, history)
+	sort.Slice(rels, func(i, j int) bool { return rels[i].GetVersion() > rels[j].GetVersion() })
+	for i, rel := range rels {
+		switch rel.GetInfo().GetStatus().GetCode() {
+		case release.Status_DEPLOYED:
+			if i == 0 {
+				return 0
+			}
+			return rel.GetVersion()
+		case release.Status_SUPERSEDED:
+			return rel.GetVersion()
+		}
+	}
+	return 0
+}
@@ -2,24 +2,38 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	helmCRDApi "github.com/bitnami-labs/helm-crd/pkg/apis/helm.bitnami.com/v1"
 	helmCrdV1 "github.com/bitnami-labs/helm-crd/pkg/apis/helm.bitnami.com/v1"
 	helmCRDFake "github.com/bitnami-labs/helm-crd/pkg/client/clientset/versioned/fake"
+	chartUtils "github.com/bitnami-labs/helm-crd/pkg/utils/chart"
+	corev1 "k8s.io/api/core/v1"
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/helm/pkg/helm"
 	"k8s.io/helm/pkg/proto/hapi/chart"
 	"k8s.io/helm/pkg/proto/hapi/release"
+	rls "k8s.io/helm/pkg/proto/hapi/services"
 	"k8s.io/helm/pkg/repo"
 )
 
@@ -60,9 +74,15 @@ type fakeHTTPClient struct {
 	repoURLs  []string
 	chartURLs []string
 	index     *repo.IndexFile
+	// Authorization headers received
+	authHeaders []string
+	mutex       sync.Mutex
 }
 
 func (f *fakeHTTPClient) Do(h *http.Request) (*http.Response, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.authHeaders = append(f.authHeaders, h.Header.Get("Authorization"))
 	for _, repoURL := range f.repoURLs {
 		if h.URL.String() == fmt.Sprintf("%sindex.yaml", repoURL) {
 			// Return fake chart index (not customizable per repo)
@@ -103,14 +123,15 @@ func prepareTestController(hrs []helmCRDApi.HelmRelease, existingTillerReleases
 		hrObjects = append(hrObjects, &hr)
 	}
 	index := &repo.IndexFile{APIVersion: "v1", Generated: time.Now(), Entries: entries}
-	netClient := fakeHTTPClient{repoURLs, chartURLs, index}
+	netClient := fakeHTTPClient{repoURLs: repoURLs, chartURLs: chartURLs, index: index}
 	helmClient := helm.FakeClient{}
 	for _, r := range existingTillerReleases {
 		helmClient.Rels = append(helmClient.Rels, &release.Release{Name: r})
 	}
 	clientset := helmCRDFake.NewSimpleClientset(hrObjects...)
 	kubeClient := fake.NewSimpleClientset()
-	controller := NewController(clientset, kubeClient, &helmClient, &netClient, fakeLoadChart)
+	controller := NewController(clientset, kubeClient, &helmClient, &netClient, fakeLoadChart, 0, watchOptions{})
+	controller.recorder = record.NewFakeRecorder(100)
 	for _, hr := range hrs {
 		controller.informer.GetIndexer().Add(&hr)
 	}
@@ -151,6 +172,123 @@ func TestHelmReleaseAdded(t *testing.T) {
 	// because the fake InstallReleaseFromChart ignores the given chart
 }
 
+func TestHelmReleaseStatus(t *testing.T) {
+	myNsFoo := metav1.ObjectMeta{
+		Namespace:  "myns",
+		Name:       "foo",
+		Generation: 2,
+	}
+	h := helmCRDApi.HelmRelease{
+		ObjectMeta: myNsFoo,
+		Spec: helmCRDApi.HelmReleaseSpec{
+			RepoURL:   "http://charts.example.com/repo/",
+			ChartName: "foo",
+			Version:   "v1.0.0",
+		},
+	}
+	controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+
+	err := controller.updateRelease("myns/foo")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	res, err := controller.helmReleaseClient.HelmV1().HelmReleases("myns").Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if res.Status.ReleaseStatus != "DEPLOYED" {
+		t.Errorf("Expected release status DEPLOYED received %s", res.Status.ReleaseStatus)
+	}
+	if res.Status.Revision != 1 {
+		t.Errorf("Expected revision 1 received %d", res.Status.Revision)
+	}
+	if res.Status.ObservedGeneration != myNsFoo.Generation {
+		t.Errorf("Expected observed generation %d received %d", myNsFoo.Generation, res.Status.ObservedGeneration)
+	}
+	if res.Status.LastError != "" {
+		t.Errorf("Unexpected error in status %s", res.Status.LastError)
+	}
+	expectedConditions := map[helmCRDApi.HelmReleaseConditionType]corev1.ConditionStatus{
+		helmCRDApi.HelmReleaseReady:       corev1.ConditionTrue,
+		helmCRDApi.HelmReleaseReconciling: corev1.ConditionFalse,
+		helmCRDApi.HelmReleaseFailed:      corev1.ConditionFalse,
+	}
+	for condType, condStatus := range expectedConditions {
+		cond := getCondition(&res.Status, condType)
+		if cond == nil {
+			t.Errorf("Expected condition %s to be set", condType)
+			continue
+		}
+		if cond.Status != condStatus || cond.Reason != reasonReleaseDeployed {
+			t.Errorf("Expected condition %s to be %s/%s received %s/%s", condType, condStatus, reasonReleaseDeployed, cond.Status, cond.Reason)
+		}
+	}
+}
+
+func TestHelmReleaseStatusError(t *testing.T) {
+	myNsFoo := metav1.ObjectMeta{
+		Namespace: "myns",
+		Name:      "foo",
+	}
+	h := helmCRDApi.HelmRelease{
+		ObjectMeta: myNsFoo,
+		Spec: helmCRDApi.HelmReleaseSpec{
+			RepoURL:   "http://charts.example.com/repo/",
+			ChartName: "foo",
+			Version:   "v1.0.0",
+		},
+	}
+	tests := []struct {
+		name           string
+		spec           helmCRDApi.HelmReleaseSpec
+		expectedReason string
+	}{
+		{
+			"repo unreachable",
+			helmCRDApi.HelmReleaseSpec{RepoURL: "http://unknown.example.com/repo/", ChartName: "foo", Version: "v1.0.0"},
+			reasonRepoIndexFetchFailed,
+		},
+		{
+			"chart version not found",
+			helmCRDApi.HelmReleaseSpec{RepoURL: "http://charts.example.com/repo/", ChartName: "foo", Version: "v2.0.0"},
+			reasonChartNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+			hr := h.DeepCopy()
+			hr.Spec = tt.spec
+			controller.informer.GetIndexer().Update(hr)
+
+			err := controller.updateRelease("myns/foo")
+			if err == nil {
+				t.Fatalf("Expected error")
+			}
+			res, err := controller.helmReleaseClient.HelmV1().HelmReleases("myns").Get("foo", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if res.Status.LastError == "" {
+				t.Errorf("Expected error to be recorded in status")
+			}
+			cond := getCondition(&res.Status, helmCRDApi.HelmReleaseFailed)
+			if cond == nil || cond.Status != corev1.ConditionTrue || cond.Reason != tt.expectedReason {
+				t.Errorf("Expected Failed condition with reason %s received %v", tt.expectedReason, cond)
+			}
+			cond = getCondition(&res.Status, helmCRDApi.HelmReleaseReady)
+			if cond == nil || cond.Status != corev1.ConditionFalse {
+				t.Errorf("Expected Ready condition to be False received %v", cond)
+			}
+			// The controller no longer works on the failed release
+			cond = getCondition(&res.Status, helmCRDApi.HelmReleaseReconciling)
+			if cond == nil || cond.Status != corev1.ConditionFalse || cond.Reason != tt.expectedReason {
+				t.Errorf("Expected Reconciling condition to be False with reason %s received %v", tt.expectedReason, cond)
+			}
+		})
+	}
+}
+
 func TestHelmReleaseAddedWithReleaseName(t *testing.T) {
 	myNsFoo := metav1.ObjectMeta{
 		Namespace: "myns",
@@ -243,3 +381,1679 @@ func TestHelmReleaseDeleted(t *testing.T) {
 		t.Errorf("Unexpected amount of releases %d, it should be empty", len(rels.Releases))
 	}
 }
+
+// checkEvents verifies that the recorded events start with the expected
+// "<type> <reason>" prefixes, in order
+func checkEvents(t *testing.T, controller *Controller, expected []string) {
+	events := controller.recorder.(*record.FakeRecorder).Events
+	for _, e := range expected {
+		select {
+		case event := <-events:
+			if !strings.HasPrefix(event, e+" ") {
+				t.Errorf("Expected event %q received %q", e, event)
+			}
+		default:
+			t.Errorf("Expected event %q, none received", e)
+		}
+	}
+	select {
+	case event := <-events:
+		t.Errorf("Unexpected event %q", event)
+	default:
+	}
+}
+
+func TestHelmReleaseEvents(t *testing.T) {
+	myNsFoo := metav1.ObjectMeta{
+		Namespace: "myns",
+		Name:      "foo",
+	}
+	h := helmCRDApi.HelmRelease{
+		ObjectMeta: myNsFoo,
+		Spec: helmCRDApi.HelmReleaseSpec{
+			ReleaseName: "bar",
+			RepoURL:     "http://charts.example.com/repo/",
+			ChartName:   "foo",
+			Version:     "v1.0.0",
+		},
+	}
+
+	t.Run("install", func(t *testing.T) {
+		controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+		if err := controller.updateRelease("myns/foo"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		checkEvents(t, controller, []string{"Normal " + reasonInstalling, "Normal " + reasonInstalled})
+	})
+
+	t.Run("upgrade", func(t *testing.T) {
+		controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{"bar"})
+		if err := controller.updateRelease("myns/foo"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		checkEvents(t, controller, []string{"Normal " + reasonUpgrading, "Normal " + reasonUpgraded})
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		hr := h.DeepCopy()
+		hr.DeletionTimestamp = &metav1.Time{}
+		hr.Finalizers = []string{releaseFinalizer}
+		controller := prepareTestController([]helmCRDApi.HelmRelease{*hr}, []string{"bar"})
+		if err := controller.updateRelease("myns/foo"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		checkEvents(t, controller, []string{"Normal " + reasonDeleted})
+	})
+
+	t.Run("chart download failure", func(t *testing.T) {
+		controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+		(*controller.netClient).(*fakeHTTPClient).chartURLs = nil
+		if err := controller.updateRelease("myns/foo"); err == nil {
+			t.Errorf("Expected error")
+		}
+		checkEvents(t, controller, []string{"Warning " + reasonChartFetchFailed})
+	})
+
+	t.Run("giving up", func(t *testing.T) {
+		controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+		(*controller.netClient).(*fakeHTTPClient).chartURLs = nil
+		for i := 0; i < maxRetries; i++ {
+			controller.queue.AddRateLimited("myns/foo")
+		}
+		controller.queue.Add("myns/foo")
+		controller.processNextItem()
+		checkEvents(t, controller, []string{"Warning " + reasonChartFetchFailed, "Warning " + reasonRetriesExhausted})
+	})
+}
+
+// fakeRollbackClient counts the rollbacks requested to a helm.FakeClient
+type fakeRollbackClient struct {
+	*helm.FakeClient
+	rollbacks int
+}
+
+func (c *fakeRollbackClient) RollbackRelease(rlsName string, opts ...helm.RollbackOption) (*rls.RollbackReleaseResponse, error) {
+	c.rollbacks++
+	return c.FakeClient.RollbackRelease(rlsName, opts...)
+}
+
+func mockRelease(name string, version int32, code release.Status_Code) *release.Release {
+	return helm.ReleaseMock(&helm.MockReleaseOptions{Name: name, Version: version, StatusCode: code})
+}
+
+func TestLastGoodRevision(t *testing.T) {
+	tests := []struct {
+		name     string
+		history  []*release.Release
+		expected int32
+	}{
+		{"empty", []*release.Release{}, 0},
+		{"latest deployed", []*release.Release{
+			mockRelease("foo", 2, release.Status_DEPLOYED),
+			mockRelease("foo", 1, release.Status_SUPERSEDED),
+		}, 0},
+		{"latest failed", []*release.Release{
+			mockRelease("foo", 3, release.Status_FAILED),
+			mockRelease("foo", 2, release.Status_DEPLOYED),
+			mockRelease("foo", 1, release.Status_SUPERSEDED),
+		}, 2},
+		{"unordered, skipping failures", []*release.Release{
+			mockRelease("foo", 1, release.Status_SUPERSEDED),
+			mockRelease("foo", 3, release.Status_FAILED),
+			mockRelease("foo", 2, release.Status_FAILED),
+		}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if res := lastGoodRevision(tt.history); res != tt.expected {
+				t.Errorf("Expected revision %d received %d", tt.expected, res)
+			}
+		})
+	}
+}
+
+func TestHelmReleaseRollback(t *testing.T) {
+	myNsFoo := metav1.ObjectMeta{
+		Namespace: "myns",
+		Name:      "foo",
+	}
+	h := helmCRDApi.HelmRelease{
+		ObjectMeta: myNsFoo,
+		Spec: helmCRDApi.HelmReleaseSpec{
+			ReleaseName: "bar",
+			RepoURL:     "http://charts.example.com/repo/",
+			ChartName:   "foo",
+			Version:     "v1.0.0",
+			Rollback:    &helmCRDApi.HelmReleaseRollback{Revision: 1},
+		},
+	}
+	controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+	helmClient := &fakeRollbackClient{FakeClient: controller.helmClient.(*helm.FakeClient)}
+	helmClient.Rels = []*release.Release{mockRelease("bar", 2, release.Status_DEPLOYED)}
+	controller.helmClient = helmClient
+
+	err := controller.updateRelease("myns/foo")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if helmClient.rollbacks != 1 {
+		t.Errorf("Expected one rollback received %d", helmClient.rollbacks)
+	}
+	res, err := controller.helmReleaseClient.HelmV1().HelmReleases("myns").Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if res.Status.RollbackRevision != 1 {
+		t.Errorf("Expected rollback revision 1 received %d", res.Status.RollbackRevision)
+	}
+	checkEvents(t, controller, []string{"Normal " + reasonRolledBack})
+
+	// Once rolled back, the release stays pinned
+	controller.informer.GetIndexer().Update(res)
+	err = controller.updateRelease("myns/foo")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if helmClient.rollbacks != 1 {
+		t.Errorf("Expected no further rollbacks received %d", helmClient.rollbacks)
+	}
+}
+
+func TestHelmReleaseRollbackOnFailure(t *testing.T) {
+	myNsFoo := metav1.ObjectMeta{
+		Namespace: "myns",
+		Name:      "foo",
+	}
+	h := helmCRDApi.HelmRelease{
+		ObjectMeta: myNsFoo,
+		Spec: helmCRDApi.HelmReleaseSpec{
+			ReleaseName: "bar",
+			RepoURL:     "http://charts.example.com/repo/",
+			ChartName:   "foo",
+			Version:     "v1.0.0",
+		},
+	}
+
+	for _, rollbackOnFailure := range []bool{true, false} {
+		t.Run(fmt.Sprintf("rollbackOnFailure=%v", rollbackOnFailure), func(t *testing.T) {
+			hr := h.DeepCopy()
+			hr.Spec.Upgrade.RollbackOnFailure = rollbackOnFailure
+			controller := prepareTestController([]helmCRDApi.HelmRelease{*hr}, []string{})
+			helmClient := &fakeRollbackClient{FakeClient: controller.helmClient.(*helm.FakeClient)}
+			// The fake upgrade returns the first release, which failed
+			helmClient.Rels = []*release.Release{
+				mockRelease("bar", 3, release.Status_FAILED),
+				mockRelease("bar", 2, release.Status_SUPERSEDED),
+			}
+			controller.helmClient = helmClient
+
+			err := controller.updateRelease("myns/foo")
+			if err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+			res, err := controller.helmReleaseClient.HelmV1().HelmReleases("myns").Get("foo", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			cond := getCondition(&res.Status, helmCRDApi.HelmReleaseFailed)
+			if !rollbackOnFailure {
+				if helmClient.rollbacks != 0 {
+					t.Errorf("Unexpected rollback")
+				}
+				if cond == nil || cond.Reason != reasonReleaseNotDeployed {
+					t.Errorf("Expected Failed condition with reason %s received %v", reasonReleaseNotDeployed, cond)
+				}
+				return
+			}
+			if helmClient.rollbacks != 1 {
+				t.Errorf("Expected one rollback received %d", helmClient.rollbacks)
+			}
+			if res.Status.RollbackRevision != 2 {
+				t.Errorf("Expected rollback revision 2 received %d", res.Status.RollbackRevision)
+			}
+			if cond == nil || cond.Status != corev1.ConditionTrue || cond.Reason != reasonRolledBack {
+				t.Errorf("Expected Failed condition with reason %s received %v", reasonRolledBack, cond)
+			}
+			if res.Status.LastError == "" {
+				t.Errorf("Expected upgrade error to be recorded in status")
+			}
+			if f := res.Status.FailedUpgrade; f == nil || f.Generation != res.Generation || f.Error != res.Status.LastError {
+				t.Errorf("Expected failed upgrade to be recorded in status, received %+v", f)
+			}
+
+			// The failed upgrade isn't retried on resyncs
+			controller.informer.GetIndexer().Update(res)
+			if err := controller.updateRelease("myns/foo"); err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+			if helmClient.rollbacks != 1 {
+				t.Errorf("Expected no further rollbacks received %d", helmClient.rollbacks)
+			}
+			res, err = controller.helmReleaseClient.HelmV1().HelmReleases("myns").Get("foo", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if res.Status.LastError == "" || getCondition(&res.Status, helmCRDApi.HelmReleaseFailed).Reason != reasonRolledBack {
+				t.Errorf("Expected the failed upgrade to stay in status, received %+v", res.Status)
+			}
+
+			// But is once the backoff expires
+			res.Status.FailedUpgrade.Time = metav1.NewTime(time.Now().Add(-failedUpgradeBackoff))
+			controller.informer.GetIndexer().Update(res)
+			if err := controller.updateRelease("myns/foo"); err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+			if helmClient.rollbacks != 2 {
+				t.Errorf("Expected a second rollback received %d", helmClient.rollbacks)
+			}
+
+			// Or the spec changes
+			res, err = controller.helmReleaseClient.HelmV1().HelmReleases("myns").Get("foo", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			res.Generation++
+			controller.informer.GetIndexer().Update(res)
+			if err := controller.updateRelease("myns/foo"); err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+			if helmClient.rollbacks != 3 {
+				t.Errorf("Expected a third rollback received %d", helmClient.rollbacks)
+			}
+		})
+	}
+}
+
+func TestReleaseDrift(t *testing.T) {
+	deployed := helm.ReleaseMock(&helm.MockReleaseOptions{Name: "bar"})
+	spec := helmCRDApi.HelmReleaseSpec{
+		ChartName: deployed.Chart.Metadata.Name,
+		Version:   deployed.Chart.Metadata.Version,
+		Values:    deployed.Config.Raw,
+	}
+	status := helmCRDApi.HelmReleaseStatus{Revision: deployed.Version}
+	tests := []struct {
+		name   string
+		update func(h *helmCRDApi.HelmRelease)
+		drift  bool
+	}{
+		{"in sync", func(h *helmCRDApi.HelmRelease) {}, false},
+		{"in sync with latest version", func(h *helmCRDApi.HelmRelease) {
+			h.Spec.Version = ""
+			h.Status.ChartVersion = deployed.Chart.Metadata.Version
+		}, false},
+		{"chart name", func(h *helmCRDApi.HelmRelease) { h.Spec.ChartName = "other" }, true},
+		{"chart version", func(h *helmCRDApi.HelmRelease) { h.Spec.Version = "2.0.0" }, true},
+		{"values", func(h *helmCRDApi.HelmRelease) { h.Spec.Values = "foo: bar" }, true},
+		{"values formatting", func(h *helmCRDApi.HelmRelease) {
+			h.Spec.Values = "# comment\n" + strings.Replace(deployed.Config.Raw, ": ", ":   ", -1)
+		}, false},
+		{"reused values", func(h *helmCRDApi.HelmRelease) {
+			h.Spec.Values = "foo: bar"
+			h.Spec.Upgrade.ReuseValues = true
+		}, false},
+		{"revision", func(h *helmCRDApi.HelmRelease) { h.Status.Revision = 2 }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &helmCRDApi.HelmRelease{Spec: *spec.DeepCopy(), Status: *status.DeepCopy()}
+			tt.update(h)
+			drift := releaseDrift(h, deployed, h.Spec.Values)
+			if tt.drift && drift == "" {
+				t.Errorf("Expected drift to be detected")
+			}
+			if !tt.drift && drift != "" {
+				t.Errorf("Unexpected drift %s", drift)
+			}
+		})
+	}
+
+	failed := helm.ReleaseMock(&helm.MockReleaseOptions{Name: "bar", StatusCode: release.Status_FAILED})
+	if drift := releaseDrift(&helmCRDApi.HelmRelease{Spec: spec, Status: status}, failed, spec.Values); drift == "" {
+		t.Errorf("Expected failed release to be reported as drift")
+	}
+}
+
+func TestHelmReleaseResync(t *testing.T) {
+	deployed := helm.ReleaseMock(&helm.MockReleaseOptions{Name: "bar"})
+	h := helmCRDApi.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "myns",
+			Name:       "foo",
+			Finalizers: []string{releaseFinalizer},
+		},
+		Spec: helmCRDApi.HelmReleaseSpec{
+			ReleaseName: "bar",
+			RepoURL:     "http://charts.example.com/repo/",
+			ChartName:   deployed.Chart.Metadata.Name,
+			Version:     deployed.Chart.Metadata.Version,
+			Values:      deployed.Config.Raw,
+		},
+		Status: helmCRDApi.HelmReleaseStatus{
+			Revision:      deployed.Version,
+			ChartVersion:  deployed.Chart.Metadata.Version,
+			ReleaseStatus: deployed.Info.Status.Code.String(),
+		},
+	}
+	setReleaseStatusConditions(&h.Status, "bar")
+
+	t.Run("in sync", func(t *testing.T) {
+		controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+		controller.helmClient.(*helm.FakeClient).Rels = []*release.Release{deployed}
+		if err := controller.updateRelease("myns/foo"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		checkEvents(t, controller, []string{})
+	})
+
+	t.Run("drifted", func(t *testing.T) {
+		controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+		drifted := helm.ReleaseMock(&helm.MockReleaseOptions{Name: "bar", Version: 2})
+		controller.helmClient.(*helm.FakeClient).Rels = []*release.Release{drifted}
+		if err := controller.updateRelease("myns/foo"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		checkEvents(t, controller, []string{
+			"Warning " + reasonDriftDetected,
+			"Normal " + reasonUpgrading,
+			"Normal " + reasonUpgraded,
+		})
+		res, err := controller.helmReleaseClient.HelmV1().HelmReleases("myns").Get("foo", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if res.Status.Drift == "" {
+			t.Errorf("Expected drift to be recorded in status")
+		}
+	})
+}
+
+func TestUpgradeNeeded(t *testing.T) {
+	deployed := helm.ReleaseMock(&helm.MockReleaseOptions{Name: "bar"})
+	other := helm.ReleaseMock(&helm.MockReleaseOptions{Name: "bar"}).Chart
+	other.Metadata.Version = "2.0.0"
+	tests := []struct {
+		name     string
+		rel      *release.Release
+		chart    *chart.Chart
+		values   string
+		expected bool
+	}{
+		{"same chart and values", deployed, deployed.Chart, deployed.Config.Raw, false},
+		{"same values, different formatting", deployed, deployed.Chart, "name:   value\n", false},
+		{"different values", deployed, deployed.Chart, "name: other", true},
+		{"different chart", deployed, other, deployed.Config.Raw, true},
+		{"failed release", helm.ReleaseMock(&helm.MockReleaseOptions{Name: "bar", StatusCode: release.Status_FAILED}), deployed.Chart, deployed.Config.Raw, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if res := upgradeNeeded(tt.rel, tt.chart, tt.values); res != tt.expected {
+				t.Errorf("Expected %v received %v", tt.expected, res)
+			}
+		})
+	}
+}
+
+func TestHelmReleaseUpgradeSkipped(t *testing.T) {
+	deployed := helm.ReleaseMock(&helm.MockReleaseOptions{Name: "bar"})
+	h := helmCRDApi.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "myns",
+			Name:      "foo",
+		},
+		Spec: helmCRDApi.HelmReleaseSpec{
+			ReleaseName: "bar",
+			RepoURL:     "http://charts.example.com/repo/",
+			ChartName:   deployed.Chart.Metadata.Name,
+			Version:     deployed.Chart.Metadata.Version,
+			Values:      deployed.Config.Raw,
+		},
+	}
+	controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+	controller.helmClient.(*helm.FakeClient).Rels = []*release.Release{deployed}
+	controller.loadChart = func(in io.Reader) (*chart.Chart, error) {
+		return deployed.Chart, nil
+	}
+
+	if err := controller.updateRelease("myns/foo"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	checkEvents(t, controller, []string{})
+	res, err := controller.helmReleaseClient.HelmV1().HelmReleases("myns").Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if res.Status.Revision != deployed.Version {
+		t.Errorf("Expected revision %d received %d", deployed.Version, res.Status.Revision)
+	}
+	if cond := getCondition(&res.Status, helmCRDApi.HelmReleaseReady); cond == nil || cond.Status != corev1.ConditionTrue {
+		t.Errorf("Expected release to be ready, received %v", cond)
+	}
+}
+
+func TestHelmReleaseValuesFormatting(t *testing.T) {
+	deployed := helm.ReleaseMock(&helm.MockReleaseOptions{Name: "bar"})
+	h := helmCRDApi.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "myns",
+			Name:       "foo",
+			Finalizers: []string{releaseFinalizer},
+			Generation: 2,
+		},
+		Spec: helmCRDApi.HelmReleaseSpec{
+			ReleaseName: "bar",
+			RepoURL:     "http://charts.example.com/repo/",
+			ChartName:   deployed.Chart.Metadata.Name,
+			Version:     deployed.Chart.Metadata.Version,
+			// Only comments and formatting changed
+			Values: "# reformatted\nname:   value\n",
+		},
+		Status: helmCRDApi.HelmReleaseStatus{
+			ObservedGeneration: 1,
+			Revision:           deployed.Version,
+			ChartVersion:       deployed.Chart.Metadata.Version,
+			ReleaseStatus:      deployed.Info.Status.Code.String(),
+			Drift:              "values differ",
+		},
+	}
+	setReleaseStatusConditions(&h.Status, "bar")
+	controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+	controller.helmClient.(*helm.FakeClient).Rels = []*release.Release{deployed}
+	controller.loadChart = func(in io.Reader) (*chart.Chart, error) {
+		return deployed.Chart, nil
+	}
+
+	// The spec change is reconciled without an upgrade, then resyncs
+	// find no drift
+	for i := 0; i < 2; i++ {
+		if err := controller.updateRelease("myns/foo"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		checkEvents(t, controller, []string{})
+		res, err := controller.helmReleaseClient.HelmV1().HelmReleases("myns").Get("foo", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if res.Status.Drift != "" {
+			t.Errorf("Expected drift to be cleared, received %q", res.Status.Drift)
+		}
+		if res.Status.Revision != deployed.Version {
+			t.Errorf("Expected revision %d received %d", deployed.Version, res.Status.Revision)
+		}
+		controller.informer.GetIndexer().Update(res)
+	}
+}
+
+func TestHelmReleaseChartRef(t *testing.T) {
+	content := "chart archive"
+	layerDigest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content)))
+	manifest := fmt.Sprintf(`{"schemaVersion": 2, "layers": [{"mediaType": "application/vnd.cncf.helm.chart.content.v1.tar+gzip", "digest": %q}]}`, layerDigest)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/charts/foo/manifests/1.0.0":
+			io.WriteString(w, manifest)
+		case "/v2/charts/foo/blobs/" + layerDigest:
+			io.WriteString(w, content)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	tests := []struct {
+		name string
+		spec helmCRDApi.HelmReleaseSpec
+	}{
+		{"chart ref", helmCRDApi.HelmReleaseSpec{ChartRef: fmt.Sprintf("oci://%s/charts/foo:1.0.0", registry)}},
+		{"chart ref and version", helmCRDApi.HelmReleaseSpec{ChartRef: fmt.Sprintf("oci://%s/charts/foo", registry), Version: "1.0.0"}},
+		{"oci repo", helmCRDApi.HelmReleaseSpec{RepoURL: fmt.Sprintf("oci://%s/charts/", registry), ChartName: "foo", Version: "1.0.0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := helmCRDApi.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "foo"}, Spec: tt.spec}
+			controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+			var netClient chartUtils.HTTPClient = server.Client()
+			controller.netClient = &netClient
+			var loaded string
+			controller.loadChart = func(in io.Reader) (*chart.Chart, error) {
+				data, err := ioutil.ReadAll(in)
+				loaded = string(data)
+				return &chart.Chart{}, err
+			}
+			if err := controller.updateRelease("myns/foo"); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if loaded != content {
+				t.Errorf("Expected chart layer to be loaded, received %q", loaded)
+			}
+			if len(controller.helmClient.(*helm.FakeClient).Rels) != 1 {
+				t.Errorf("Expected release to be installed")
+			}
+		})
+	}
+}
+
+func TestHelmReleaseChartRefCredentials(t *testing.T) {
+	content := "chart archive"
+	layerDigest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content)))
+	manifest := fmt.Sprintf(`{"schemaVersion": 2, "layers": [{"mediaType": "application/vnd.cncf.helm.chart.content.v1.tar+gzip", "digest": %q}]}`, layerDigest)
+	var authHeaders []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeaders = append(authHeaders, r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/v2/charts/foo/manifests/1.0.0":
+			io.WriteString(w, manifest)
+		case "/v2/charts/foo/blobs/" + layerDigest:
+			io.WriteString(w, content)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	chartRef := fmt.Sprintf("oci://%s/charts/foo:1.0.0", strings.TrimPrefix(server.URL, "https://"))
+
+	tests := []struct {
+		name              string
+		repository        *helmCRDApi.HelmReleaseRepositoryRef
+		defaultRepository string
+		reason            string
+	}{
+		{"cluster repository", &helmCRDApi.HelmReleaseRepositoryRef{Kind: clusterHelmRepositoryKind, Name: "internal"}, "", reasonRepositoryNotFound},
+		{"default repository", nil, "internal", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authHeaders = nil
+			h := helmCRDApi.HelmRelease{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "foo"},
+				Spec:       helmCRDApi.HelmReleaseSpec{Repository: tt.repository, ChartRef: chartRef},
+			}
+			controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+			var netClient chartUtils.HTTPClient = server.Client()
+			controller.netClient = &netClient
+			controller.loadChart = func(in io.Reader) (*chart.Chart, error) {
+				return &chart.Chart{}, nil
+			}
+			controller.kubeClient = fake.NewSimpleClientset(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "creds"},
+				Data:       map[string][]byte{"header": []byte("Bearer s3cr3t")},
+			})
+			controller.clusterRepositoryInformer.GetIndexer().Add(&helmCRDApi.ClusterHelmRepository{
+				ObjectMeta: metav1.ObjectMeta{Name: "internal"},
+				Spec: helmCRDApi.HelmRepositorySpec{
+					URL: "oci://registry.internal.example.com/charts",
+					Auth: helmCRDApi.HelmReleaseAuth{Header: &helmCRDApi.HelmReleaseAuthHeader{
+						SecretKeyRef: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "creds"}, Key: "header"},
+						Namespace:    "kube-system",
+					}},
+				},
+			})
+			controller.defaultRepository = tt.defaultRepository
+
+			err := controller.updateRelease("myns/foo")
+			if tt.reason != "" {
+				if errorReason(err) != tt.reason {
+					t.Errorf("Expected %s error received %v", tt.reason, err)
+				}
+			} else if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			// The registry of another host never gets the credentials
+			for _, header := range authHeaders {
+				if header != "" {
+					t.Errorf("Expected no Authorization header received %q", header)
+				}
+			}
+		})
+	}
+}
+
+func TestChartName(t *testing.T) {
+	h := &helmCRDApi.HelmRelease{Spec: helmCRDApi.HelmReleaseSpec{ChartName: "foo"}}
+	if name := chartName(h); name != "foo" {
+		t.Errorf("Expected foo received %s", name)
+	}
+	h.Spec.ChartRef = "oci://registry.example.com/charts/bar:1.0.0"
+	if name := chartName(h); name != "bar" {
+		t.Errorf("Expected bar received %s", name)
+	}
+}
+
+func TestHelmReleaseAuth(t *testing.T) {
+	secret := func(namespace, name string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Data: map[string][]byte{
+				"header":                    []byte("Bearer " + namespace + "-" + name),
+				"token":                     []byte("t0k3n\n"),
+				corev1.BasicAuthUsernameKey: []byte("user"),
+				corev1.BasicAuthPasswordKey: []byte("pass"),
+			},
+		}
+	}
+	headerRef := func(name, key, namespace string) *helmCRDApi.HelmReleaseAuthHeader {
+		return &helmCRDApi.HelmReleaseAuthHeader{SecretKeyRef: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}, Namespace: namespace}
+	}
+	tests := []struct {
+		name      string
+		auth      helmCRDApi.HelmReleaseAuth
+		allowlist []string
+		expected  string
+		reason    string
+	}{
+		{
+			name:     "release namespace",
+			auth:     helmCRDApi.HelmReleaseAuth{Header: headerRef("creds", "header", "")},
+			expected: "Bearer myns-creds",
+		},
+		{
+			name:   "other namespace",
+			auth:   helmCRDApi.HelmReleaseAuth{Header: headerRef("creds", "header", "kube-system")},
+			reason: reasonAuthSecretForbidden,
+		},
+		{
+			name:      "other namespace, allowed",
+			auth:      helmCRDApi.HelmReleaseAuth{Header: headerRef("creds", "header", "kube-system")},
+			allowlist: []string{"myns:kube-system/creds"},
+			expected:  "Bearer kube-system-creds",
+		},
+		{
+			name:      "other namespace, allowed for other releases",
+			auth:      helmCRDApi.HelmReleaseAuth{Header: headerRef("creds", "header", "kube-system")},
+			allowlist: []string{"otherns:kube-system/*", "kube-system/other"},
+			reason:    reasonAuthSecretForbidden,
+		},
+		{
+			name:   "missing secret",
+			auth:   helmCRDApi.HelmReleaseAuth{Header: headerRef("other", "header", "")},
+			reason: reasonAuthSecretError,
+		},
+		{
+			name:   "missing key",
+			auth:   helmCRDApi.HelmReleaseAuth{Header: headerRef("creds", "other", "")},
+			reason: reasonAuthSecretError,
+		},
+		{
+			name:     "basic",
+			auth:     helmCRDApi.HelmReleaseAuth{Basic: &helmCRDApi.HelmReleaseAuthBasic{SecretRef: corev1.LocalObjectReference{Name: "creds"}}},
+			expected: "Basic dXNlcjpwYXNz",
+		},
+		{
+			name:   "basic, other namespace",
+			auth:   helmCRDApi.HelmReleaseAuth{Basic: &helmCRDApi.HelmReleaseAuthBasic{SecretRef: corev1.LocalObjectReference{Name: "creds"}, Namespace: "kube-system"}},
+			reason: reasonAuthSecretForbidden,
+		},
+		{
+			name: "bearer token",
+			auth: helmCRDApi.HelmReleaseAuth{BearerToken: &helmCRDApi.HelmReleaseAuthBearerToken{
+				SecretKeyRef: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "creds"}, Key: "token"},
+			}},
+			expected: "Bearer t0k3n",
+		},
+		{
+			name: "header and basic",
+			auth: helmCRDApi.HelmReleaseAuth{
+				Header: headerRef("creds", "header", ""),
+				Basic:  &helmCRDApi.HelmReleaseAuthBasic{SecretRef: corev1.LocalObjectReference{Name: "creds"}},
+			},
+			reason: reasonInvalidAuth,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := helmCRDApi.HelmRelease{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "foo"},
+				Spec: helmCRDApi.HelmReleaseSpec{
+					RepoURL:   "http://charts.example.com/repo/",
+					ChartName: "foo",
+					Version:   "v1.0.0",
+					Auth:      *tt.auth.DeepCopy(),
+				},
+			}
+			controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+			controller.kubeClient = fake.NewSimpleClientset(secret("myns", "creds"), secret("kube-system", "creds"))
+			allowlist, err := parseSecretAllowlist(tt.allowlist)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			controller.secretAllowlist = allowlist
+
+			err = controller.updateRelease("myns/foo")
+			netClient := (*controller.netClient).(*fakeHTTPClient)
+			if tt.reason != "" {
+				if err == nil {
+					t.Fatalf("Expected error")
+				}
+				checkEvents(t, controller, []string{"Warning " + tt.reason})
+				if len(netClient.authHeaders) != 0 {
+					t.Errorf("Unexpected requests to the chart repository")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if len(netClient.authHeaders) == 0 {
+				t.Errorf("Expected requests to the chart repository")
+			}
+			for _, header := range netClient.authHeaders {
+				if header != tt.expected {
+					t.Errorf("Expected Authorization header %q received %q", tt.expected, header)
+				}
+			}
+		})
+	}
+}
+
+// testCAPEM is a CA certificate for TLS settings
+const testCAPEM = `-----BEGIN CERTIFICATE-----
+MIIBhTCCASugAwIBAgIQIRi6zePL6mKjOipn+dNuaTAKBggqhkjOPQQDAjASMRAw
+DgYDVQQKEwdBY21lIENvMB4XDTE3MTAyMDE5NDMwNloXDTE4MTAyMDE5NDMwNlow
+EjEQMA4GA1UEChMHQWNtZSBDbzBZMBMGByqGSM49AgEGCCqGSM49AwEHA0IABD0d
+7VNhbWvZLWPuj/RtHFjvtJBEwOkhbN/BnnE8rnZR8+sbwnc/KhCk3FhnpHZnQz7B
+5aETbbIgmuvewdjvSBSjYzBhMA4GA1UdDwEB/wQEAwICpDATBgNVHSUEDDAKBggr
+BgEFBQcDATAPBgNVHRMBAf8EBTADAQH/MCkGA1UdEQQiMCCCDmxvY2FsaG9zdDo1
+NDUzgg4xMjcuMC4wLjE6NTQ1MzAKBggqhkjOPQQDAgNIADBFAiEA2zpJEPQyz6/l
+Wf86aX6PepsntZv2GYlA5UpabfT2EZICICpJ5h/iI+i341gBmLiAFQOyTDT+/wQc
+6MF9+Yw1Yy0t
+-----END CERTIFICATE-----
+`
+
+func TestHelmReleaseAuthTLS(t *testing.T) {
+	h := helmCRDApi.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "foo"},
+		Spec: helmCRDApi.HelmReleaseSpec{
+			RepoURL:   "http://charts.example.com/repo/",
+			ChartName: "foo",
+			Version:   "v1.0.0",
+			Auth: helmCRDApi.HelmReleaseAuth{
+				TLS: &helmCRDApi.HelmReleaseAuthTLS{
+					CAConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "ca"}, Key: "ca.crt"},
+				},
+			},
+		},
+	}
+	controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+	controller.kubeClient = fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "ca"},
+		Data:       map[string]string{"ca.crt": testCAPEM},
+	})
+	defaultClient := (*controller.netClient).(*fakeHTTPClient)
+	tlsClient := fakeHTTPClient{repoURLs: defaultClient.repoURLs, chartURLs: defaultClient.chartURLs, index: defaultClient.index}
+	var configs []*tls.Config
+	controller.newHTTPClient = func(config *tls.Config) chartUtils.HTTPClient {
+		configs = append(configs, config)
+		return &tlsClient
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := controller.updateRelease("myns/foo"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	if len(configs) != 1 {
+		t.Fatalf("Expected a single client to be built, received %d", len(configs))
+	}
+	if configs[0].RootCAs == nil {
+		t.Errorf("Expected CA to be configured")
+	}
+	if len(tlsClient.authHeaders) == 0 || len(defaultClient.authHeaders) != 0 {
+		t.Errorf("Expected requests to use the TLS client")
+	}
+
+	controller.kubeClient = fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "ca"},
+		Data:       map[string]string{"ca.crt": "not a certificate"},
+	})
+	if err := controller.updateRelease("myns/foo"); errorReason(err) != reasonInvalidAuth {
+		t.Errorf("Expected %s error received %v", reasonInvalidAuth, err)
+	}
+
+	// ConfigMaps in other namespaces must be allowed like Secrets
+	h.Spec.Auth.TLS.Namespace = "kube-system"
+	controller.informer.GetIndexer().Update(&h)
+	controller.kubeClient = fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "ca"},
+		Data:       map[string]string{"ca.crt": testCAPEM},
+	})
+	if err := controller.updateRelease("myns/foo"); errorReason(err) != reasonAuthSecretForbidden {
+		t.Errorf("Expected %s error received %v", reasonAuthSecretForbidden, err)
+	}
+	controller.secretAllowlist = secretAllowlist{{releaseNamespace: "*", namespace: "kube-system", name: "ca"}}
+	if err := controller.updateRelease("myns/foo"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestHelmRepository(t *testing.T) {
+	repoURL := "http://charts.example.com/repo/"
+	h := helmCRDApi.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "foo"},
+		Spec: helmCRDApi.HelmReleaseSpec{
+			RepoURL:   repoURL,
+			ChartName: "foo",
+			Version:   "v1.0.0",
+		},
+	}
+	controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+	netClient := (*controller.netClient).(*fakeHTTPClient)
+	repository := &helmCRDApi.HelmRepository{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "internal"},
+		Spec:       helmCRDApi.HelmRepositorySpec{URL: repoURL},
+	}
+	broken := &helmCRDApi.HelmRepository{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "broken"},
+		Spec:       helmCRDApi.HelmRepositorySpec{URL: "http://charts.example.com/other/"},
+	}
+	controller.helmReleaseClient = helmCRDFake.NewSimpleClientset(&h, repository, broken)
+	controller.repositoryInformer.GetIndexer().Add(repository)
+	controller.repositoryInformer.GetIndexer().Add(broken)
+
+	if err := controller.syncRepository("HelmRepository/myns/internal"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	res, err := controller.helmReleaseClient.HelmV1().HelmRepositories("myns").Get("internal", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if res.Status.Charts != 1 || res.Status.LastFetchTime == nil || len(res.Status.Conditions) != 1 ||
+		res.Status.Conditions[0].Status != corev1.ConditionTrue || res.Status.Conditions[0].Reason != reasonIndexFetched {
+		t.Errorf("Unexpected status %+v", res.Status)
+	}
+
+	if err := controller.syncRepository("HelmRepository/myns/broken"); err == nil {
+		t.Errorf("Expected error fetching the index of a broken repository")
+	}
+	res, err = controller.helmReleaseClient.HelmV1().HelmRepositories("myns").Get("broken", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if res.Status.LastError == "" || len(res.Status.Conditions) != 1 ||
+		res.Status.Conditions[0].Status != corev1.ConditionFalse || res.Status.Conditions[0].Reason != reasonRepoIndexFetchFailed {
+		t.Errorf("Unexpected status %+v", res.Status)
+	}
+
+	// The release uses the cached index, only fetching the chart
+	h.Spec.RepoURL = ""
+	h.Spec.Repository = &helmCRDApi.HelmReleaseRepositoryRef{Name: "internal"}
+	controller.informer.GetIndexer().Update(&h)
+	requests := len(netClient.authHeaders)
+	if err := controller.updateRelease("myns/foo"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if n := len(netClient.authHeaders) - requests; n != 1 {
+		t.Errorf("Expected a single request, received %d", n)
+	}
+	if keys, _ := controller.informer.GetIndexer().IndexKeys(repositoryIndex, "HelmRepository/myns/internal"); len(keys) != 1 {
+		t.Errorf("Expected release to be indexed by repository, received %v", keys)
+	}
+
+	h.Spec.Repository = &helmCRDApi.HelmReleaseRepositoryRef{Name: "internal", Kind: clusterHelmRepositoryKind}
+	controller.informer.GetIndexer().Update(&h)
+	if err := controller.updateRelease("myns/foo"); errorReason(err) != reasonRepositoryNotFound {
+		t.Errorf("Expected %s error received %v", reasonRepositoryNotFound, err)
+	}
+}
+
+func TestRepositoryHandler(t *testing.T) {
+	h := helmCRDApi.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "foo"},
+		Spec: helmCRDApi.HelmReleaseSpec{
+			Repository: &helmCRDApi.HelmReleaseRepositoryRef{Name: "internal"},
+			ChartName:  "foo",
+		},
+	}
+	controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+	handler := controller.repositoryHandler(helmRepositoryKind)
+	repository := &helmCRDApi.HelmRepository{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "internal"},
+		Spec:       helmCRDApi.HelmRepositorySpec{URL: "http://charts.example.com/repo/"},
+	}
+	moved := repository.DeepCopy()
+	moved.Spec.URL = "http://charts.example.com/other/"
+
+	// Releases are reconciled again whenever their repository appears,
+	// changes or disappears
+	for _, test := range []struct {
+		name  string
+		event func()
+	}{
+		{"add", func() { handler.OnAdd(repository) }},
+		{"update", func() { handler.OnUpdate(repository, moved) }},
+		{"delete", func() { handler.OnDelete(moved) }},
+		{"tombstone", func() { handler.OnDelete(cache.DeletedFinalStateUnknown{Key: "myns/internal", Obj: moved}) }},
+	} {
+		test.event()
+		if n := controller.repoQueue.Len(); n != 1 {
+			t.Errorf("%s: expected the repository to be queued, received %d items", test.name, n)
+		}
+		if n := controller.queue.Len(); n != 1 {
+			t.Errorf("%s: expected the release to be queued, received %d items", test.name, n)
+		}
+		for controller.repoQueue.Len() > 0 {
+			key, _ := controller.repoQueue.Get()
+			controller.repoQueue.Done(key)
+		}
+		for controller.queue.Len() > 0 {
+			key, _ := controller.queue.Get()
+			controller.queue.Done(key)
+		}
+	}
+}
+
+func TestClusterHelmRepositoryAuth(t *testing.T) {
+	repoURL := "http://charts.example.com/repo/"
+	h := helmCRDApi.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "foo"},
+		Spec: helmCRDApi.HelmReleaseSpec{
+			RepoURL:   repoURL,
+			ChartName: "foo",
+			Version:   "v1.0.0",
+		},
+	}
+	tests := []struct {
+		name      string
+		namespace string
+		expected  string
+		reason    string
+	}{
+		{"secret namespace", "kube-system", "Bearer s3cr3t", ""},
+		{"no secret namespace", "", "", reasonInvalidAuth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+			controller.kubeClient = fake.NewSimpleClientset(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "creds"},
+				Data:       map[string][]byte{"header": []byte("Bearer s3cr3t")},
+			})
+			repository := &helmCRDApi.ClusterHelmRepository{
+				ObjectMeta: metav1.ObjectMeta{Name: "internal"},
+				Spec: helmCRDApi.HelmRepositorySpec{
+					URL: repoURL,
+					Auth: helmCRDApi.HelmReleaseAuth{Header: &helmCRDApi.HelmReleaseAuthHeader{
+						SecretKeyRef: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "creds"}, Key: "header"},
+						Namespace:    tt.namespace,
+					}},
+				},
+			}
+			controller.clusterRepositoryInformer.GetIndexer().Add(repository)
+			// Used as default repository
+			controller.defaultRepository = "internal"
+			hr := h.DeepCopy()
+			hr.Spec.RepoURL = ""
+			controller.informer.GetIndexer().Update(hr)
+
+			err := controller.updateRelease("myns/foo")
+			netClient := (*controller.netClient).(*fakeHTTPClient)
+			if tt.reason != "" {
+				if errorReason(err) != tt.reason {
+					t.Errorf("Expected %s error received %v", tt.reason, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			for _, header := range netClient.authHeaders {
+				if header != tt.expected {
+					t.Errorf("Expected Authorization header %q received %q", tt.expected, header)
+				}
+			}
+		})
+	}
+}
+
+func TestHelmReleaseIndexCache(t *testing.T) {
+	h := helmCRDApi.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "foo"},
+		Spec: helmCRDApi.HelmReleaseSpec{
+			RepoURL:   "http://charts.example.com/repo/",
+			ChartName: "foo",
+			Version:   "v1.0.0",
+		},
+	}
+	controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+	netClient := (*controller.netClient).(*fakeHTTPClient)
+
+	for i, expected := range []int{2, 1} {
+		requests := len(netClient.authHeaders)
+		if err := controller.updateRelease("myns/foo"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if n := len(netClient.authHeaders) - requests; n != expected {
+			t.Errorf("Reconcile %d: expected %d requests, received %d", i, expected, n)
+		}
+	}
+	if stats := controller.indexCache.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Unexpected index cache stats %+v", stats)
+	}
+}
+
+func TestHelmReleaseArchiveCache(t *testing.T) {
+	h := helmCRDApi.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "foo"},
+		Spec: helmCRDApi.HelmReleaseSpec{
+			RepoURL:   "http://charts.example.com/repo/",
+			ChartName: "foo",
+			Version:   "v1.0.0",
+		},
+	}
+	controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+	netClient := (*controller.netClient).(*fakeHTTPClient)
+	dir, err := ioutil.TempDir("", "archive-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if controller.archiveCache, err = chartUtils.NewArchiveCache(dir, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unchanged releases are reconciled without network requests
+	for i, expected := range []int{2, 0} {
+		requests := len(netClient.authHeaders)
+		if err := controller.updateRelease("myns/foo"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if n := len(netClient.authHeaders) - requests; n != expected {
+			t.Errorf("Reconcile %d: expected %d requests, received %d", i, expected, n)
+		}
+	}
+}
+
+func TestHelmReleaseArchiveCacheTLS(t *testing.T) {
+	h := helmCRDApi.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "foo"},
+		Spec: helmCRDApi.HelmReleaseSpec{
+			RepoURL:   "http://charts.example.com/repo/",
+			ChartName: "foo",
+			Version:   "v1.0.0",
+			Auth: helmCRDApi.HelmReleaseAuth{
+				TLS: &helmCRDApi.HelmReleaseAuthTLS{
+					CAConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "ca"}, Key: "ca.crt"},
+				},
+			},
+		},
+	}
+	controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+	dir, err := ioutil.TempDir("", "archive-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if controller.archiveCache, err = chartUtils.NewArchiveCache(dir, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	defaultClient := (*controller.netClient).(*fakeHTTPClient)
+	var tlsClients []*fakeHTTPClient
+	controller.newHTTPClient = func(config *tls.Config) chartUtils.HTTPClient {
+		client := &fakeHTTPClient{repoURLs: defaultClient.repoURLs, chartURLs: defaultClient.chartURLs, index: defaultClient.index}
+		tlsClients = append(tlsClients, client)
+		return client
+	}
+	reconcile := func(caPEM string, client func() *fakeHTTPClient, expected int) {
+		t.Helper()
+		controller.kubeClient = fake.NewSimpleClientset(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "ca"},
+			Data:       map[string]string{"ca.crt": caPEM},
+		})
+		if err := controller.updateRelease("myns/foo"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if n := len(client().authHeaders); n != expected {
+			t.Errorf("Expected %d requests, received %d", expected, n)
+		}
+	}
+	lastClient := func() *fakeHTTPClient { return tlsClients[len(tlsClients)-1] }
+
+	// The index and chart downloaded with a TLS identity are reused by
+	// it only
+	reconcile(testCAPEM, lastClient, 2)
+	reconcile(testCAPEM, lastClient, 2)
+	reconcile(testCAPEM+testCAPEM, lastClient, 2)
+	if len(tlsClients) != 2 {
+		t.Errorf("Expected 2 TLS clients, received %d", len(tlsClients))
+	}
+	hr := h.DeepCopy()
+	hr.Spec.Auth = helmCRDApi.HelmReleaseAuth{}
+	controller.informer.GetIndexer().Update(hr)
+	reconcile(testCAPEM, func() *fakeHTTPClient { return defaultClient }, 2)
+}
+
+func TestHelmReleaseVerify(t *testing.T) {
+	h := helmCRDApi.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "foo"},
+		Spec: helmCRDApi.HelmReleaseSpec{
+			RepoURL:   "http://charts.example.com/repo/",
+			ChartName: "foo",
+			Version:   "v1.0.0",
+		},
+	}
+	// Digest of the empty archives served by fakeHTTPClient
+	emptyDigest := fmt.Sprintf("%x", sha256.Sum256(nil))
+	verify := &helmCRDApi.HelmReleaseVerify{
+		KeyringSecretKeyRef: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "keyring"}, Key: "pubring.gpg"},
+	}
+	tests := []struct {
+		name   string
+		digest string
+		verify *helmCRDApi.HelmReleaseVerify
+		reason string
+	}{
+		{"digest", emptyDigest, nil, ""},
+		{"no digest", "", nil, ""},
+		{"digest mismatch", strings.Repeat("0", 64), nil, reasonVerificationFailed},
+		{"missing provenance", emptyDigest, verify, reasonVerificationFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hr := h.DeepCopy()
+			hr.Spec.Verify = tt.verify
+			controller := prepareTestController([]helmCRDApi.HelmRelease{*hr}, []string{})
+			controller.kubeClient = fake.NewSimpleClientset(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "keyring"},
+				Data:       map[string][]byte{"pubring.gpg": []byte("keyring")},
+			})
+			netClient := (*controller.netClient).(*fakeHTTPClient)
+			netClient.index.Entries["foo"][0].Digest = tt.digest
+
+			err := controller.updateRelease("myns/foo")
+			rels, _ := controller.helmClient.ListReleases()
+			if tt.reason != "" {
+				if errorReason(err) != tt.reason {
+					t.Errorf("Expected %s error received %v", tt.reason, err)
+				}
+				if len(rels.GetReleases()) != 0 {
+					t.Errorf("Unexpected release installed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if len(rels.GetReleases()) != 1 {
+				t.Errorf("Expected release to be installed")
+			}
+		})
+	}
+}
+
+func TestHelmReleaseVersionRange(t *testing.T) {
+	ch := &chart.Chart{Metadata: &chart.Metadata{Name: "foo", Version: "1.0.0"}}
+	deployed := helm.ReleaseMock(&helm.MockReleaseOptions{Name: "bar", Chart: ch})
+	h := helmCRDApi.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "myns",
+			Name:       "foo",
+			Finalizers: []string{releaseFinalizer},
+		},
+		Spec: helmCRDApi.HelmReleaseSpec{
+			ReleaseName: "bar",
+			RepoURL:     "http://charts.example.com/repo/",
+			ChartName:   "foo",
+			Version:     "~1.0",
+			Values:      deployed.Config.Raw,
+		},
+		Status: helmCRDApi.HelmReleaseStatus{
+			Revision:      deployed.Version,
+			ChartVersion:  "1.0.0",
+			ReleaseStatus: deployed.Info.Status.Code.String(),
+		},
+	}
+	setReleaseStatusConditions(&h.Status, "bar")
+
+	controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+	controller.helmClient.(*helm.FakeClient).Rels = []*release.Release{deployed}
+	controller.indexCache = chartUtils.NewIndexCache(0)
+	controller.versionPollInterval = 10 * time.Millisecond
+	netClient := (*controller.netClient).(*fakeHTTPClient)
+	netClient.index = repo.NewIndexFile()
+	for _, v := range []string{"1.0.0", "1.0.2-rc.1", "2.0.0"} {
+		netClient.index.Add(&chart.Metadata{Name: "foo", Version: v}, "foo-"+v+".tgz", "http://charts.example.com/repo/", "")
+	}
+	netClient.index.SortEntries()
+
+	// The deployed version is still the newest matching one
+	if err := controller.updateRelease("myns/foo"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	checkEvents(t, controller, []string{})
+
+	// Releases of ranges are checked again after the poll interval
+	time.Sleep(100 * time.Millisecond)
+	if n := controller.queue.Len(); n != 1 {
+		t.Errorf("Expected the release to be queued, queue length is %d", n)
+	}
+
+	netClient.index.Add(&chart.Metadata{Name: "foo", Version: "1.0.1"}, "foo-1.0.1.tgz", "http://charts.example.com/repo/", "")
+	netClient.index.SortEntries()
+	netClient.chartURLs = []string{"http://charts.example.com/repo/foo-1.0.1.tgz"}
+	controller.loadChart = func(in io.Reader) (*chart.Chart, error) {
+		return &chart.Chart{Metadata: &chart.Metadata{Name: "foo", Version: "1.0.1"}}, nil
+	}
+	if err := controller.updateRelease("myns/foo"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	checkEvents(t, controller, []string{
+		"Normal " + reasonNewChartVersion,
+		"Normal " + reasonUpgrading,
+		"Normal " + reasonUpgraded,
+	})
+	res, err := controller.helmReleaseClient.HelmV1().HelmReleases("myns").Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if res.Status.ChartVersion != "1.0.1" {
+		t.Errorf("Expected chart version 1.0.1 in status, received %q", res.Status.ChartVersion)
+	}
+}
+
+func TestHasVersionRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     helmCRDApi.HelmReleaseSpec
+		expected bool
+	}{
+		{"version", helmCRDApi.HelmReleaseSpec{Version: "1.0.0"}, false},
+		{"range", helmCRDApi.HelmReleaseSpec{Version: "~1.0"}, true},
+		{"latest", helmCRDApi.HelmReleaseSpec{}, false},
+		{"any version", helmCRDApi.HelmReleaseSpec{Version: "*"}, true},
+		{"rollback", helmCRDApi.HelmReleaseSpec{Version: "~1.0", Rollback: &helmCRDApi.HelmReleaseRollback{Revision: 1}}, false},
+		{"OCI tag", helmCRDApi.HelmReleaseSpec{ChartRef: "oci://registry.example.com/charts/foo:1.0.0", Version: "~1.0"}, false},
+		{"OCI range", helmCRDApi.HelmReleaseSpec{ChartRef: "oci://registry.example.com/charts/foo", Version: "~1.0"}, true},
+		{"git branch", helmCRDApi.HelmReleaseSpec{Source: &helmCRDApi.HelmReleaseSource{Git: &helmCRDApi.HelmReleaseGitSource{Ref: "master"}}}, true},
+		{"git commit", helmCRDApi.HelmReleaseSpec{Source: &helmCRDApi.HelmReleaseSource{Git: &helmCRDApi.HelmReleaseGitSource{Ref: strings.Repeat("a", 40)}}}, false},
+	}
+	for _, tt := range tests {
+		if res := hasVersionRange(&helmCRDApi.HelmRelease{Spec: tt.spec}); res != tt.expected {
+			t.Errorf("%s: expected %v received %v", tt.name, tt.expected, res)
+		}
+	}
+}
+
+// pushGitChart commits a chart of the given version under charts/foo
+// in the work tree, pushes it to the bare repository remote and
+// returns the commit
+func pushGitChart(t *testing.T, work, remote, version string) string {
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = work
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s failed: %v: %s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	if _, err := os.Stat(remote); os.IsNotExist(err) {
+		git("init", "--bare", "--quiet", remote)
+		git("init", "--quiet", ".")
+	}
+	dir := filepath.Join(work, "charts", "foo")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	chartfile := "apiVersion: v1\nname: foo\nversion: " + version + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte(chartfile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "-A")
+	git("commit", "--quiet", "-m", version)
+	git("push", "--quiet", remote, "HEAD:refs/heads/master")
+	return git("rev-parse", "HEAD")
+}
+
+// serveGitRepositories serves the git repositories under root over
+// http, with git http-backend
+func serveGitRepositories(t *testing.T, root string) *httptest.Server {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(&cgi.Handler{
+		Path: gitPath,
+		Args: []string{"http-backend"},
+		Env:  []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1"},
+	})
+}
+
+func TestHelmReleaseGitSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	work, remote := filepath.Join(dir, "work"), filepath.Join(dir, "remote.git")
+	if err := os.MkdirAll(work, 0755); err != nil {
+		t.Fatal(err)
+	}
+	first := pushGitChart(t, work, remote, "1.0.0")
+	server := serveGitRepositories(t, dir)
+	defer server.Close()
+
+	h := helmCRDApi.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "foo"},
+		Spec: helmCRDApi.HelmReleaseSpec{
+			ReleaseName: "bar",
+			Source: &helmCRDApi.HelmReleaseSource{Git: &helmCRDApi.HelmReleaseGitSource{
+				URL:  server.URL + "/remote.git",
+				Ref:  "master",
+				Path: "charts/foo",
+			}},
+		},
+	}
+	controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+	controller.versionPollInterval = time.Minute
+
+	// Git sources are disabled without a cache
+	if err := controller.updateRelease("myns/foo"); err == nil {
+		t.Fatalf("Expected error without a git cache")
+	}
+	if controller.gitCache, err = chartUtils.NewGitCache(filepath.Join(dir, "cache"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.updateRelease("myns/foo"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	res, err := controller.helmReleaseClient.HelmV1().HelmReleases("myns").Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if res.Status.GitCommit != first || res.Status.ChartVersion != "1.0.0" {
+		t.Errorf("Expected commit %s and version 1.0.0 in status, received %+v", first, res.Status)
+	}
+
+	// New commits of the branch are deployed
+	ch := &chart.Chart{Metadata: &chart.Metadata{Name: "foo", Version: "1.0.0"}}
+	deployed := helm.ReleaseMock(&helm.MockReleaseOptions{Name: "bar", Chart: ch})
+	controller.helmClient.(*helm.FakeClient).Rels = []*release.Release{deployed}
+	res.Status.Revision = deployed.Version
+	res.Spec.Values = deployed.Config.Raw
+	setReleaseStatusConditions(&res.Status, "bar")
+	controller.informer.GetIndexer().Update(res)
+	second := pushGitChart(t, work, remote, "1.1.0")
+	if err := controller.updateRelease("myns/foo"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	checkEvents(t, controller, []string{
+		"Warning " + reasonChartFetchFailed,
+		"Normal " + reasonInstalling,
+		"Normal " + reasonInstalled,
+		"Normal " + reasonNewChartVersion,
+		"Normal " + reasonUpgrading,
+		"Normal " + reasonUpgraded,
+	})
+	res, err = controller.helmReleaseClient.HelmV1().HelmReleases("myns").Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if res.Status.GitCommit != second || res.Status.ChartVersion != "1.1.0" {
+		t.Errorf("Expected commit %s and version 1.1.0 in status, received %+v", second, res.Status)
+	}
+}
+
+func TestHelmReleaseChartURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "local-charts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	index := repo.NewIndexFile()
+	index.Add(&chart.Metadata{Name: "foo", Version: "1.0.0"}, "foo-1.0.0.tgz", "", "")
+	if err := index.WriteFile(filepath.Join(dir, "index.yaml"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "foo-1.0.0.tgz"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		spec          helmCRDApi.HelmReleaseSpec
+		localChartDir string
+		expectedErr   bool
+	}{
+		{"http chart", helmCRDApi.HelmReleaseSpec{ChartURL: "http://charts.example.com/foo-1.0.0.tgz"}, "", false},
+		{"missing http chart", helmCRDApi.HelmReleaseSpec{ChartURL: "http://charts.example.com/bar-1.0.0.tgz"}, "", true},
+		{"file chart", helmCRDApi.HelmReleaseSpec{ChartURL: "file://" + dir + "/foo-1.0.0.tgz"}, dir, false},
+		{"file repository", helmCRDApi.HelmReleaseSpec{RepoURL: "file://" + dir + "/", ChartName: "foo", Version: "1.0.0"}, dir, false},
+		{"file URLs disabled", helmCRDApi.HelmReleaseSpec{ChartURL: "file://" + dir + "/foo-1.0.0.tgz"}, "", true},
+		{"file outside of the local chart directory", helmCRDApi.HelmReleaseSpec{ChartURL: "file://" + dir + "/foo-1.0.0.tgz"}, filepath.Join(dir, "other"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := helmCRDApi.HelmRelease{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "foo"},
+				Spec:       tt.spec,
+			}
+			controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+			(*controller.netClient).(*fakeHTTPClient).chartURLs = []string{"http://charts.example.com/foo-1.0.0.tgz"}
+			controller.localChartDir = tt.localChartDir
+			err := controller.updateRelease("myns/foo")
+			if tt.expectedErr {
+				if err == nil {
+					t.Errorf("Expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			rels, err := controller.helmClient.ListReleases()
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if len(rels.Releases) != 1 {
+				t.Errorf("Expected 1 release, received %d", len(rels.Releases))
+			}
+		})
+	}
+}
+
+func TestHelmReleaseMirrors(t *testing.T) {
+	mirrorURL := "http://mirror.example.com/repo/"
+	h := helmCRDApi.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "foo"},
+		Spec: helmCRDApi.HelmReleaseSpec{
+			RepoURL:   "http://charts.example.com/repo/",
+			Mirrors:   []string{"http://down.example.com/repo/", mirrorURL},
+			ChartName: "foo",
+			Version:   "v1.0.0",
+		},
+	}
+	controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+	netClient := (*controller.netClient).(*fakeHTTPClient)
+	// The repository is down: the index is served by the second mirror,
+	// and the chart by the second URL of its entry
+	netClient.repoURLs = []string{mirrorURL}
+	netClient.index.Entries["foo"][0].URLs = []string{"http://charts.example.com/repo/foo-v1.0.0.tgz", "foo-v1.0.0.tgz"}
+	netClient.chartURLs = []string{mirrorURL + "foo-v1.0.0.tgz"}
+
+	if err := controller.updateRelease("myns/foo"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	res, err := controller.helmReleaseClient.HelmV1().HelmReleases("myns").Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if res.Status.Source != mirrorURL+"foo-v1.0.0.tgz" {
+		t.Errorf("Expected source %s received %s", mirrorURL+"foo-v1.0.0.tgz", res.Status.Source)
+	}
+
+	// HelmRepositories record the mirror their index was fetched from
+	repository := &helmCRDApi.HelmRepository{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "internal"},
+		Spec:       helmCRDApi.HelmRepositorySpec{URL: "http://charts.example.com/repo/", Mirrors: []string{mirrorURL}},
+	}
+	controller.helmReleaseClient = helmCRDFake.NewSimpleClientset(&h, repository)
+	controller.repositoryInformer.GetIndexer().Add(repository)
+	if err := controller.syncRepository("HelmRepository/myns/internal"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	repoRes, err := controller.helmReleaseClient.HelmV1().HelmRepositories("myns").Get("internal", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if repoRes.Status.URL != strings.TrimSuffix(mirrorURL, "/") || repoRes.Status.Charts != 1 {
+		t.Errorf("Unexpected status %+v", repoRes.Status)
+	}
+
+	// No source left
+	netClient.repoURLs = nil
+	controller.indexCache = chartUtils.NewIndexCache(0)
+	if err := controller.updateRelease("myns/foo"); errorReason(err) != reasonRepoIndexFetchFailed {
+		t.Errorf("Expected %s error received %v", reasonRepoIndexFetchFailed, err)
+	}
+}
+
+// concurrentHelmClient is a FakeClient safe for concurrent use, with
+// the release history filtered by name. Installs and upgrades take
+// delay, and are tracked to check the concurrency of workers.
+type concurrentHelmClient struct {
+	*helm.FakeClient
+	delay time.Duration
+
+	mutex sync.Mutex
+	// Operations in progress, overall and by namespace
+	running, maxRunning int
+	runningByNamespace  map[string]int
+	overlapping         bool
+}
+
+func (f *concurrentHelmClient) track(namespace string, delta int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.running += delta
+	if f.running > f.maxRunning {
+		f.maxRunning = f.running
+	}
+	f.runningByNamespace[namespace] += delta
+	if f.runningByNamespace[namespace] > 1 {
+		f.overlapping = true
+	}
+}
+
+func (f *concurrentHelmClient) InstallReleaseFromChart(ch *chart.Chart, ns string, opts ...helm.InstallOption) (*rls.InstallReleaseResponse, error) {
+	f.track(ns, 1)
+	defer f.track(ns, -1)
+	time.Sleep(f.delay)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.FakeClient.InstallReleaseFromChart(ch, ns, opts...)
+}
+
+func (f *concurrentHelmClient) UpdateReleaseFromChart(rlsName string, ch *chart.Chart, opts ...helm.UpdateOption) (*rls.UpdateReleaseResponse, error) {
+	ns := strings.TrimSuffix(rlsName, "-foo")
+	f.track(ns, 1)
+	defer f.track(ns, -1)
+	time.Sleep(f.delay)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.FakeClient.UpdateReleaseFromChart(rlsName, ch, opts...)
+}
+
+func (f *concurrentHelmClient) ListReleases(opts ...helm.ReleaseListOption) (*rls.ListReleasesResponse, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.FakeClient.ListReleases(opts...)
+}
+
+func (f *concurrentHelmClient) ReleaseContent(rlsName string, opts ...helm.ContentOption) (*rls.GetReleaseContentResponse, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.FakeClient.ReleaseContent(rlsName, opts...)
+}
+
+func (f *concurrentHelmClient) ReleaseHistory(rlsName string, opts ...helm.HistoryOption) (*rls.GetHistoryResponse, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var releases []*release.Release
+	for _, r := range f.Rels {
+		if r.Name == rlsName {
+			releases = append(releases, r)
+		}
+	}
+	return &rls.GetHistoryResponse{Releases: releases}, nil
+}
+
+func (f *concurrentHelmClient) stats() (running, maxRunning int, overlapping bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.running, f.maxRunning, f.overlapping
+}
+
+func TestConcurrentWorkers(t *testing.T) {
+	const releases, workers, maxTillerOperations = 20, 8, 3
+	hrs := make([]helmCRDApi.HelmRelease, releases)
+	var objs []runtime.Object
+	for i := range hrs {
+		hrs[i] = helmCRDApi.HelmRelease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: fmt.Sprintf("ns%d", i), Name: "foo"},
+			Spec: helmCRDApi.HelmReleaseSpec{
+				RepoURL:   "http://charts.example.com/repo/",
+				ChartName: "foo",
+				Version:   "v1.0.0",
+			},
+		}
+		objs = append(objs, &hrs[i])
+	}
+	controller := prepareTestController(hrs, []string{})
+	controller.helmReleaseClient = helmCRDFake.NewSimpleClientset(objs...)
+	for i := range hrs {
+		controller.informer.GetIndexer().Add(&hrs[i])
+	}
+	// Events are not consumed
+	controller.recorder = record.NewFakeRecorder(100 * releases)
+	helmClient := &concurrentHelmClient{FakeClient: &helm.FakeClient{}, delay: 20 * time.Millisecond, runningByNamespace: map[string]int{}}
+	controller.helmClient = helmClient
+	controller.workers = workers
+	controller.tillerOperations = make(chan struct{}, maxTillerOperations)
+
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		controller.runWorkers(stop)
+		close(stopped)
+	}()
+
+	// Each release is queued again while being reconciled
+	for n := 0; n < 3; n++ {
+		for i := range hrs {
+			controller.queue.Add(hrs[i].Namespace + "/foo")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		rels, _ := helmClient.ListReleases()
+		if len(rels.GetReleases()) == releases && controller.queue.Len() == 0 {
+			if running, _, _ := helmClient.stats(); running == 0 {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d releases, received %d", releases, len(rels.GetReleases()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_, maxRunning, overlapping := helmClient.stats()
+	if overlapping {
+		t.Errorf("A release was reconciled by several workers at once")
+	}
+	if maxRunning != maxTillerOperations {
+		t.Errorf("Expected %d concurrent Tiller operations, received %d", maxTillerOperations, maxRunning)
+	}
+
+	// Workers stop once stop is closed
+	close(stop)
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Errorf("Timed out waiting for workers to stop")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+
+	helmCrdV1 "github.com/bitnami-labs/helm-crd/pkg/apis/helm.bitnami.com/v1"
+	chartUtils "github.com/bitnami-labs/helm-crd/pkg/utils/chart"
+)
+
+// Key of the known hosts in the Secrets of git ssh keys
+const knownHostsKey = "known_hosts"
+
+// gitSource returns the git source of helmObj, or nil if its chart
+// comes from a repository
+func gitSource(helmObj *helmCrdV1.HelmRelease) *helmCrdV1.HelmReleaseGitSource {
+	if helmObj.Spec.Source == nil {
+		return nil
+	}
+	return helmObj.Spec.Source.Git
+}
+
+func gitRefName(git *helmCrdV1.HelmReleaseGitSource) string {
+	if git.Ref == "" {
+		return "HEAD"
+	}
+	return git.Ref
+}
+
+// gitAuth returns the credentials to access the git repository of
+// helmObj, read from the Secrets referenced in git
+func (c *Controller) gitAuth(helmObj *helmCrdV1.HelmRelease, git *helmCrdV1.HelmReleaseGitSource) (*chartUtils.GitAuth, error) {
+	auth := &chartUtils.GitAuth{}
+	var err error
+	if auth.AuthHeader, err = c.authHeader(helmObj.Namespace, &git.Auth); err != nil {
+		return nil, err
+	}
+	if auth.CAPEM, auth.CertPEM, auth.KeyPEM, err = c.tlsCertificates(helmObj.Namespace, &git.Auth); err != nil {
+		return nil, err
+	}
+	if git.SSHKey != nil {
+		secret, err := c.getSecret(helmObj.Namespace, git.SSHKey.Namespace, git.SSHKey.SecretRef.Name)
+		if err != nil {
+			return nil, err
+		}
+		if auth.SSHKey, err = secretValue(secret, corev1.SSHAuthPrivateKey); err != nil {
+			return nil, err
+		}
+		if auth.KnownHosts, err = secretValue(secret, knownHostsKey); err != nil {
+			return nil, err
+		}
+	}
+	return auth, nil
+}
+
+// fetchGitChart checks out the chart requested by helmObj from its git
+// repository. It also returns a description of where the chart was
+// fetched from and its commit.
+func (c *Controller) fetchGitChart(helmObj *helmCrdV1.HelmRelease, git *helmCrdV1.HelmReleaseGitSource) (*chart.Chart, string, string, error) {
+	if c.gitCache == nil {
+		return nil, "", "", withReason(reasonChartFetchFailed, fmt.Errorf("git sources are not enabled"))
+	}
+	if helmObj.Spec.Verify != nil {
+		return nil, "", "", withReason(reasonVerificationFailed, fmt.Errorf("provenance verification is not supported for git sources"))
+	}
+	auth, err := c.gitAuth(helmObj, git)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	setReconciling(&helmObj.Status, reasonFetchingChart, fmt.Sprintf("Fetching %s of %s", gitRefName(git), git.URL))
+	log.Printf("Fetching %s of %s ...", gitRefName(git), git.URL)
+	chartRequested, commit, err := c.gitCache.FetchChart(git.URL, git.Ref, git.Path, auth)
+	if err != nil {
+		return nil, "", "", withReason(reasonChartFetchFailed, err)
+	}
+	source := fmt.Sprintf("%s@%s", git.URL, commit)
+	if git.Path != "" {
+		source = fmt.Sprintf("%s:%s", source, git.Path)
+	}
+	return chartRequested, source, commit, nil
+}
+
+// resolveGitCommit returns the commit the git ref of helmObj points
+// to, without checking out the chart
+func (c *Controller) resolveGitCommit(helmObj *helmCrdV1.HelmRelease, git *helmCrdV1.HelmReleaseGitSource) (string, error) {
+	if c.gitCache == nil {
+		return "", fmt.Errorf("git sources are not enabled")
+	}
+	auth, err := c.gitAuth(helmObj, git)
+	if err != nil {
+		return "", err
+	}
+	return c.gitCache.Resolve(git.URL, git.Ref, auth)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	defaultTillerPingPeriod   = 10 * time.Second
+	defaultStuckWorkerTimeout = 30 * time.Minute
+	// Number of ping periods without a ping after which Tiller is
+	// considered unreachable, in case pings hang
+	maxMissedTillerPings = 3
+)
+
+// healthChecks serves the liveness (/healthz) and readiness (/readyz)
+// probes of a Controller
+type healthChecks struct {
+	controller *Controller
+	// pingPeriod is the interval between Tiller pings
+	pingPeriod time.Duration
+	// stuckWorkerTimeout is how long a worker may reconcile a single
+	// HelmRelease before the controller is considered stuck (0 to
+	// disable)
+	stuckWorkerTimeout time.Duration
+
+	// leading is set to 1 once the controller runs, that is holds the
+	// leader election lock if enabled. Accessed atomically.
+	leading int32
+
+	mutex sync.Mutex
+	// Result and time of the last Tiller ping
+	tillerErr error
+	lastPing  time.Time
+}
+
+func newHealthChecks(c *Controller, pingPeriod, stuckWorkerTimeout time.Duration) *healthChecks {
+	return &healthChecks{
+		controller:         c,
+		pingPeriod:         pingPeriod,
+		stuckWorkerTimeout: stuckWorkerTimeout,
+		tillerErr:          fmt.Errorf("Tiller not pinged yet"),
+	}
+}
+
+// run pings Tiller every pingPeriod until stop is closed
+func (h *healthChecks) run(stop <-chan struct{}) {
+	wait.Until(h.pingTiller, h.pingPeriod, stop)
+}
+
+func (h *healthChecks) pingTiller() {
+	err := h.controller.helmClient.PingTiller()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if err != nil && h.tillerErr == nil {
+		log.Printf("Unable to reach Tiller: %v", err)
+	} else if err == nil && h.tillerErr != nil {
+		log.Print("Tiller is reachable")
+	}
+	h.tillerErr = err
+	h.lastPing = time.Now()
+}
+
+// setLeading records that the controller runs, and so must have synced
+// its caches to be ready
+func (h *healthChecks) setLeading() {
+	atomic.StoreInt32(&h.leading, 1)
+}
+
+// ready returns an error if Tiller can't be reached, or if the
+// controller runs but hasn't synced its caches yet. Replicas on
+// standby for the leader election lock are ready once Tiller can be
+// reached.
+func (h *healthChecks) ready() error {
+	h.mutex.Lock()
+	tillerErr, lastPing := h.tillerErr, h.lastPing
+	h.mutex.Unlock()
+	if tillerErr != nil {
+		return fmt.Errorf("Tiller is not reachable: %v", tillerErr)
+	}
+	if since := time.Since(lastPing); since > maxMissedTillerPings*h.pingPeriod {
+		return fmt.Errorf("Tiller not pinged for %s", since)
+	}
+	if atomic.LoadInt32(&h.leading) == 1 && !h.controller.HasSynced() {
+		return fmt.Errorf("caches not synced")
+	}
+	return nil
+}
+
+// alive returns an error if a worker has been reconciling the same
+// HelmRelease for longer than stuckWorkerTimeout
+func (h *healthChecks) alive() error {
+	if h.stuckWorkerTimeout <= 0 {
+		return nil
+	}
+	key, start := h.controller.oldestProcessing()
+	if key == "" {
+		return nil
+	}
+	if since := time.Since(start); since > h.stuckWorkerTimeout {
+		return fmt.Errorf("worker stuck reconciling %s for %s", key, since)
+	}
+	return nil
+}
+
+// handler returns the handler of the /healthz and /readyz probes
+func (h *healthChecks) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", probeHandler(h.alive))
+	mux.HandleFunc("/readyz", probeHandler(h.ready))
+	return mux
+}
+
+// probeHandler responds with 503 Service Unavailable and the error
+// returned by check, if any, or with 200 OK
+func probeHandler(check func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := check(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/helm/pkg/helm"
+
+	helmCrdV1 "github.com/bitnami-labs/helm-crd/pkg/apis/helm.bitnami.com/v1"
+)
+
+// unreachableTillerClient is a helm client whose pings fail with err
+// if set
+type unreachableTillerClient struct {
+	*helm.FakeClient
+	err error
+}
+
+func (c *unreachableTillerClient) PingTiller() error {
+	return c.err
+}
+
+// probe returns the status code and body of a GET request to path
+func probe(h *healthChecks, path string) (int, string) {
+	w := httptest.NewRecorder()
+	h.handler().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w.Code, strings.TrimSpace(w.Body.String())
+}
+
+func TestReadiness(t *testing.T) {
+	controller := prepareTestController(nil, nil)
+	helmClient := &unreachableTillerClient{FakeClient: controller.helmClient.(*helm.FakeClient)}
+	controller.helmClient = helmClient
+	h := newHealthChecks(controller, time.Minute, 0)
+
+	checkReady := func(expectedCode int, expectedBody string) {
+		t.Helper()
+		code, body := probe(h, "/readyz")
+		if code != expectedCode || !strings.Contains(body, expectedBody) {
+			t.Errorf("Expected %d %q received %d %q", expectedCode, expectedBody, code, body)
+		}
+	}
+
+	checkReady(http.StatusServiceUnavailable, "Tiller not pinged yet")
+
+	// Standby replicas only need Tiller
+	h.pingTiller()
+	checkReady(http.StatusOK, "ok")
+
+	helmClient.err = fmt.Errorf("connection refused")
+	h.pingTiller()
+	checkReady(http.StatusServiceUnavailable, "Tiller is not reachable: connection refused")
+
+	helmClient.err = nil
+	h.pingTiller()
+	h.lastPing = time.Now().Add(-5 * time.Minute)
+	checkReady(http.StatusServiceUnavailable, "Tiller not pinged for")
+
+	// The caches of a running controller must be synced
+	h.pingTiller()
+	h.setLeading()
+	checkReady(http.StatusServiceUnavailable, "caches not synced")
+}
+
+func TestLiveness(t *testing.T) {
+	controller := prepareTestController(nil, nil)
+	h := newHealthChecks(controller, time.Minute, time.Minute)
+
+	checkAlive := func(expectedCode int, expectedBody string) {
+		t.Helper()
+		code, body := probe(h, "/healthz")
+		if code != expectedCode || !strings.Contains(body, expectedBody) {
+			t.Errorf("Expected %d %q received %d %q", expectedCode, expectedBody, code, body)
+		}
+	}
+
+	checkAlive(http.StatusOK, "ok")
+
+	controller.setProcessing("myns/foo", time.Now())
+	controller.setProcessing("myns/bar", time.Now().Add(-2*time.Minute))
+	checkAlive(http.StatusServiceUnavailable, "worker stuck reconciling myns/bar")
+
+	controller.setProcessing("myns/bar", time.Time{})
+	checkAlive(http.StatusOK, "ok")
+
+	// Processed items are no longer tracked
+	controller.queue.Add("myns/baz")
+	controller.processNextItem()
+	if key, _ := controller.oldestProcessing(); key != "myns/foo" {
+		t.Errorf("Expected myns/foo to be processed, received %q", key)
+	}
+
+	h.stuckWorkerTimeout = 0
+	controller.setProcessing("myns/foo", time.Now().Add(-time.Hour))
+	checkAlive(http.StatusOK, "ok")
+}
+
+func TestLivenessTillerOperations(t *testing.T) {
+	controller := prepareTestController(nil, nil)
+	controller.tillerOperations = make(chan struct{}, 1)
+	stop := make(chan struct{})
+	controller.stopCh = stop
+	h := newHealthChecks(controller, time.Minute, time.Minute)
+	helmObj := &helmCrdV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "foo"}}
+
+	// Another release is being installed
+	otherDone, err := controller.startTillerOperation(&helmCrdV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "bar"}})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	start := time.Now().Add(-30 * time.Second)
+	controller.setProcessing("myns/foo", start)
+	started := make(chan func())
+	go func() {
+		done, err := controller.startTillerOperation(helmObj)
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		started <- done
+	}()
+
+	// Waiting for Tiller doesn't count as reconciling
+	time.Sleep(50 * time.Millisecond)
+	if key, _ := controller.oldestProcessing(); key != "" {
+		t.Errorf("Expected no release to be reconciled while waiting, received %q", key)
+	}
+	if code, body := probe(h, "/healthz"); code != http.StatusOK {
+		t.Errorf("Expected %d received %d %q", http.StatusOK, code, body)
+	}
+
+	otherDone()
+	done := <-started
+
+	// Neither does the Tiller call, bounded by spec.timeout instead
+	time.Sleep(50 * time.Millisecond)
+	if key, _ := controller.oldestProcessing(); key != "" {
+		t.Errorf("Expected no release to be reconciled during the Tiller call, received %q", key)
+	}
+	done()
+	key, resumed := controller.oldestProcessing()
+	if key != "myns/foo" || !resumed.After(start.Add(90*time.Millisecond)) {
+		t.Errorf("Expected myns/foo to be reconciled since after %s, received %q since %s", start, key, resumed)
+	}
+	controller.setProcessing("myns/foo", time.Time{})
+
+	// Workers stopping interrupt the wait
+	otherDone, _ = controller.startTillerOperation(helmObj)
+	defer otherDone()
+	close(stop)
+	if _, err := controller.startTillerOperation(helmObj); err != errStopping {
+		t.Errorf("Expected %v received %v", errStopping, err)
+	}
+}
+
+func TestTillerOperationStopping(t *testing.T) {
+	h := helmCrdV1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "foo"},
+		Spec: helmCrdV1.HelmReleaseSpec{
+			RepoURL:   "http://charts.example.com/repo/",
+			ChartName: "foo",
+			Version:   "1.0.0",
+		},
+	}
+	controller := prepareTestController([]helmCrdV1.HelmRelease{h}, nil)
+	controller.tillerOperations = make(chan struct{}, 1)
+	controller.tillerOperations <- struct{}{}
+	stop := make(chan struct{})
+	close(stop)
+	controller.stopCh = stop
+
+	// Interrupted reconciles are neither failures nor retried
+	controller.queue.Add("myns/foo")
+	controller.processNextItem()
+	if n := controller.queue.NumRequeues("myns/foo"); n != 0 {
+		t.Errorf("Expected no retry of the interrupted reconcile, received %d", n)
+	}
+	if key, _ := controller.oldestProcessing(); key != "" {
+		t.Errorf("Expected no release to be reconciled, received %q", key)
+	}
+	checkEvents(t, controller, []string{"Normal Installing"})
+}
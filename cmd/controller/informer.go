@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// watchOptions restricts the objects watched by a Controller
+type watchOptions struct {
+	// namespaces watched, all namespaces if empty. Cluster scoped
+	// objects (ClusterHelmRepositories) are only watched in all
+	// namespaces.
+	namespaces []string
+	// labelSelector selects the HelmReleases reconciled, all of them
+	// if nil
+	labelSelector labels.Selector
+}
+
+// parseWatchOptions returns the watchOptions of the given namespaces
+// and HelmRelease label selector
+func parseWatchOptions(namespaces []string, labelSelector string) (watchOptions, error) {
+	for _, namespace := range namespaces {
+		if namespace == "" {
+			return watchOptions{}, fmt.Errorf("invalid empty namespace")
+		}
+	}
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return watchOptions{}, fmt.Errorf("invalid label selector %q: %v", labelSelector, err)
+	}
+	return watchOptions{namespaces: namespaces, labelSelector: selector}, nil
+}
+
+// allNamespaces returns true if no namespace restriction is set
+func (o watchOptions) allNamespaces() bool {
+	return len(o.namespaces) == 0
+}
+
+// newListWatch returns a ListWatch of the objects of a resource in
+// namespace (all namespaces if empty) matching labelSelector
+func newListWatch(c cache.Getter, resource, namespace string, labelSelector labels.Selector) *cache.ListWatch {
+	listFunc := func(options metav1.ListOptions) (runtime.Object, error) {
+		options.LabelSelector = labelSelector.String()
+		return c.Get().
+			Namespace(namespace).
+			Resource(resource).
+			VersionedParams(&options, metav1.ParameterCodec).
+			Do().
+			Get()
+	}
+	watchFunc := func(options metav1.ListOptions) (watch.Interface, error) {
+		options.Watch = true
+		options.LabelSelector = labelSelector.String()
+		return c.Get().
+			Namespace(namespace).
+			Resource(resource).
+			VersionedParams(&options, metav1.ParameterCodec).
+			Watch()
+	}
+	return &cache.ListWatch{ListFunc: listFunc, WatchFunc: watchFunc}
+}
+
+// newInformer returns an informer of the objects of a resource in the
+// given namespaces (all namespaces if empty) matching labelSelector
+// (all objects if nil)
+func newInformer(c cache.Getter, resource string, objType runtime.Object, namespaces []string, labelSelector labels.Selector, resyncPeriod time.Duration, indexers cache.Indexers) cache.SharedIndexInformer {
+	if labelSelector == nil {
+		labelSelector = labels.Everything()
+	}
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	informers := map[string]cache.SharedIndexInformer{}
+	for _, namespace := range namespaces {
+		informers[namespace] = cache.NewSharedIndexInformer(newListWatch(c, resource, namespace, labelSelector), objType, resyncPeriod, indexers)
+	}
+	if len(informers) == 1 {
+		return informers[namespaces[0]]
+	}
+	return &multiNamespaceInformer{informers: informers}
+}
+
+// multiNamespaceInformer is a SharedIndexInformer made of an informer
+// per namespace, as the API can't list several namespaces at once
+type multiNamespaceInformer struct {
+	informers map[string]cache.SharedIndexInformer
+}
+
+var _ cache.SharedIndexInformer = &multiNamespaceInformer{}
+
+func (m *multiNamespaceInformer) AddEventHandler(handler cache.ResourceEventHandler) {
+	for _, informer := range m.informers {
+		informer.AddEventHandler(handler)
+	}
+}
+
+func (m *multiNamespaceInformer) AddEventHandlerWithResyncPeriod(handler cache.ResourceEventHandler, resyncPeriod time.Duration) {
+	for _, informer := range m.informers {
+		informer.AddEventHandlerWithResyncPeriod(handler, resyncPeriod)
+	}
+}
+
+func (m *multiNamespaceInformer) GetStore() cache.Store {
+	return m.GetIndexer()
+}
+
+func (m *multiNamespaceInformer) GetController() cache.Controller {
+	return m
+}
+
+// Run runs the informers of all namespaces until stopCh is closed
+func (m *multiNamespaceInformer) Run(stopCh <-chan struct{}) {
+	for _, informer := range m.informers {
+		go informer.Run(stopCh)
+	}
+	<-stopCh
+}
+
+func (m *multiNamespaceInformer) HasSynced() bool {
+	for _, informer := range m.informers {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// LastSyncResourceVersion returns the last synced resource versions
+// of each namespace, separated by commas
+func (m *multiNamespaceInformer) LastSyncResourceVersion() string {
+	var versions []string
+	for namespace, informer := range m.informers {
+		versions = append(versions, namespace+"="+informer.LastSyncResourceVersion())
+	}
+	return strings.Join(versions, ",")
+}
+
+func (m *multiNamespaceInformer) AddIndexers(indexers cache.Indexers) error {
+	for _, informer := range m.informers {
+		if err := informer.AddIndexers(indexers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *multiNamespaceInformer) GetIndexer() cache.Indexer {
+	indexers := map[string]cache.Indexer{}
+	for namespace, informer := range m.informers {
+		indexers[namespace] = informer.GetIndexer()
+	}
+	return multiNamespaceIndexer(indexers)
+}
+
+// multiNamespaceIndexer is an Indexer made of an Indexer per
+// namespace. Objects are stored in the Indexer of their namespace, and
+// lookups by index are merged across namespaces.
+type multiNamespaceIndexer map[string]cache.Indexer
+
+var _ cache.Indexer = multiNamespaceIndexer{}
+
+// forKey returns the Indexer of the namespace of key
+func (m multiNamespaceIndexer) forKey(key string) (cache.Indexer, error) {
+	namespace, _, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil, err
+	}
+	indexer, ok := m[namespace]
+	if !ok {
+		return nil, fmt.Errorf("namespace %q is not watched", namespace)
+	}
+	return indexer, nil
+}
+
+// forObject returns the Indexer of the namespace of obj
+func (m multiNamespaceIndexer) forObject(obj interface{}) (cache.Indexer, error) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return nil, err
+	}
+	return m.forKey(key)
+}
+
+func (m multiNamespaceIndexer) Add(obj interface{}) error {
+	indexer, err := m.forObject(obj)
+	if err != nil {
+		return err
+	}
+	return indexer.Add(obj)
+}
+
+func (m multiNamespaceIndexer) Update(obj interface{}) error {
+	indexer, err := m.forObject(obj)
+	if err != nil {
+		return err
+	}
+	return indexer.Update(obj)
+}
+
+func (m multiNamespaceIndexer) Delete(obj interface{}) error {
+	indexer, err := m.forObject(obj)
+	if err != nil {
+		return err
+	}
+	return indexer.Delete(obj)
+}
+
+func (m multiNamespaceIndexer) List() []interface{} {
+	var objs []interface{}
+	for _, indexer := range m {
+		objs = append(objs, indexer.List()...)
+	}
+	return objs
+}
+
+func (m multiNamespaceIndexer) ListKeys() []string {
+	var keys []string
+	for _, indexer := range m {
+		keys = append(keys, indexer.ListKeys()...)
+	}
+	return keys
+}
+
+func (m multiNamespaceIndexer) Get(obj interface{}) (interface{}, bool, error) {
+	indexer, err := m.forObject(obj)
+	if err != nil {
+		return nil, false, nil
+	}
+	return indexer.Get(obj)
+}
+
+// GetByKey returns the object with the given key. Objects in
+// namespaces not watched don't exist.
+func (m multiNamespaceIndexer) GetByKey(key string) (interface{}, bool, error) {
+	indexer, err := m.forKey(key)
+	if err != nil {
+		return nil, false, nil
+	}
+	return indexer.GetByKey(key)
+}
+
+// Replace is not supported: the content of each namespace is replaced
+// by its own informer
+func (m multiNamespaceIndexer) Replace(list []interface{}, resourceVersion string) error {
+	return fmt.Errorf("replace is not supported across namespaces")
+}
+
+func (m multiNamespaceIndexer) Resync() error {
+	for _, indexer := range m {
+		if err := indexer.Resync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiNamespaceIndexer) Index(indexName string, obj interface{}) ([]interface{}, error) {
+	var objs []interface{}
+	for _, indexer := range m {
+		res, err := indexer.Index(indexName, obj)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, res...)
+	}
+	return objs, nil
+}
+
+func (m multiNamespaceIndexer) IndexKeys(indexName, indexKey string) ([]string, error) {
+	var keys []string
+	for _, indexer := range m {
+		res, err := indexer.IndexKeys(indexName, indexKey)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, res...)
+	}
+	return keys, nil
+}
+
+func (m multiNamespaceIndexer) ListIndexFuncValues(indexName string) []string {
+	seen := map[string]bool{}
+	var values []string
+	for _, indexer := range m {
+		for _, value := range indexer.ListIndexFuncValues(indexName) {
+			if !seen[value] {
+				seen[value] = true
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+func (m multiNamespaceIndexer) ByIndex(indexName, indexKey string) ([]interface{}, error) {
+	var objs []interface{}
+	for _, indexer := range m {
+		res, err := indexer.ByIndex(indexName, indexKey)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, res...)
+	}
+	return objs, nil
+}
+
+func (m multiNamespaceIndexer) GetIndexers() cache.Indexers {
+	for _, indexer := range m {
+		return indexer.GetIndexers()
+	}
+	return cache.Indexers{}
+}
+
+func (m multiNamespaceIndexer) AddIndexers(indexers cache.Indexers) error {
+	for _, indexer := range m {
+		if err := indexer.AddIndexers(indexers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	helmCRDApi "github.com/bitnami-labs/helm-crd/pkg/apis/helm.bitnami.com/v1"
+)
+
+func TestParseWatchOptions(t *testing.T) {
+	watch, err := parseWatchOptions([]string{"a", "b"}, "shard=a,tier!=test")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if watch.allNamespaces() || watch.labelSelector.String() != "shard=a,tier!=test" {
+		t.Errorf("Unexpected watch options %+v", watch)
+	}
+	watch, err = parseWatchOptions(nil, "")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !watch.allNamespaces() || !watch.labelSelector.Empty() {
+		t.Errorf("Unexpected watch options %+v", watch)
+	}
+	if _, err := parseWatchOptions([]string{""}, ""); err == nil {
+		t.Errorf("Expected error for an empty namespace")
+	}
+	if _, err := parseWatchOptions(nil, "shard in (a"); err == nil {
+		t.Errorf("Expected error for an invalid selector")
+	}
+}
+
+func TestMultiNamespaceInformer(t *testing.T) {
+	indexers := cache.Indexers{"name": func(obj interface{}) ([]string, error) {
+		return []string{obj.(*corev1.ConfigMap).Name}, nil
+	}}
+	if _, ok := newInformer(nil, "configmaps", &corev1.ConfigMap{}, []string{"a"}, nil, 0, indexers).(*multiNamespaceInformer); ok {
+		t.Errorf("Expected a single informer for a single namespace")
+	}
+	informer := newInformer(nil, "configmaps", &corev1.ConfigMap{}, []string{"a", "b"}, nil, 0, indexers)
+	if _, ok := informer.(*multiNamespaceInformer); !ok {
+		t.Fatalf("Expected an informer per namespace, received %T", informer)
+	}
+
+	indexer := informer.GetIndexer()
+	for _, ns := range []string{"a", "b"} {
+		if err := indexer.Add(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "foo"}}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	if err := indexer.Add(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "c", Name: "foo"}}); err == nil {
+		t.Errorf("Expected error adding an object of a namespace not watched")
+	}
+
+	keys := indexer.ListKeys()
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "a/foo" || keys[1] != "b/foo" {
+		t.Errorf("Unexpected keys %v", keys)
+	}
+	if _, exists, err := indexer.GetByKey("b/foo"); !exists || err != nil {
+		t.Errorf("Expected b/foo to exist, received %v", err)
+	}
+	if _, exists, err := indexer.GetByKey("c/foo"); exists || err != nil {
+		t.Errorf("Expected c/foo not to exist, received %v", err)
+	}
+	objs, err := indexer.ByIndex("name", "foo")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(objs) != 2 {
+		t.Errorf("Expected 2 objects, received %d", len(objs))
+	}
+}
+
+func TestNamespacedController(t *testing.T) {
+	h := helmCRDApi.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "foo"},
+		Spec: helmCRDApi.HelmReleaseSpec{
+			ChartName:  "foo",
+			Repository: &helmCRDApi.HelmReleaseRepositoryRef{Name: "shared", Kind: clusterHelmRepositoryKind},
+		},
+	}
+	controller := prepareTestController([]helmCRDApi.HelmRelease{h}, []string{})
+	watch, err := parseWatchOptions([]string{"myns", "other"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	namespaced := NewController(controller.helmReleaseClient, controller.kubeClient, controller.helmClient, *controller.netClient, fakeLoadChart, 0, watch)
+	namespaced.recorder = controller.recorder
+	namespaced.informer.GetIndexer().Add(&h)
+
+	// ClusterHelmRepositories are not watched
+	if namespaced.clusterRepositoryInformer != nil {
+		t.Errorf("Expected ClusterHelmRepositories not to be watched")
+	}
+	if err := namespaced.updateRelease("myns/foo"); errorReason(err) != reasonRepositoryNotFound {
+		t.Errorf("Expected %s error received %v", reasonRepositoryNotFound, err)
+	}
+}
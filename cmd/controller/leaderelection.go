@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Name of the ConfigMap holding the leader election lock
+const leaderElectionLockName = "helm-crd-controller"
+
+// leaderElectionConfig holds the leader election settings
+type leaderElectionConfig struct {
+	leaseDuration time.Duration
+	renewDeadline time.Duration
+	retryPeriod   time.Duration
+}
+
+// runWithLeaderElection waits until lock is acquired, then calls run
+// until stop is closed or the lock is lost. run must return once the
+// channel it is given is closed. Losing the lock is an error, returned
+// once run has returned.
+func runWithLeaderElection(lock resourcelock.Interface, config leaderElectionConfig, run func(stop <-chan struct{}), stop <-chan struct{}) error {
+	// Closed when run is called, when it has returned, and when the
+	// lock is lost
+	started, stopped, lost := make(chan struct{}), make(chan struct{}), make(chan struct{})
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: config.leaseDuration,
+		RenewDeadline: config.renewDeadline,
+		RetryPeriod:   config.retryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leaderStop <-chan struct{}) {
+				log.Printf("Acquired leader election lock %s as %s", lock.Describe(), lock.Identity())
+				runStop := make(chan struct{})
+				go func() {
+					select {
+					case <-stop:
+					case <-leaderStop:
+					}
+					close(runStop)
+				}()
+				close(started)
+				run(runStop)
+				close(stopped)
+			},
+			OnStoppedLeading: func() {
+				close(lost)
+			},
+			OnNewLeader: func(identity string) {
+				log.Printf("Leader is %s", identity)
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Waiting for leader election lock %s as %s", lock.Describe(), lock.Identity())
+	go elector.Run()
+
+	select {
+	case <-stop:
+	case <-lost:
+	}
+	select {
+	case <-started:
+		// Let the workers finish what they are doing
+		<-stopped
+	default:
+	}
+	select {
+	case <-lost:
+		return fmt.Errorf("lost leader election lock %s", lock.Describe())
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
+)
+
+// fakeReplica runs a leader elected replica, whose run function
+// reports when it starts and stops
+type fakeReplica struct {
+	stop, started, stopped, done chan struct{}
+	err                          error
+}
+
+func startFakeReplica(t *testing.T, kubeClient kubernetes.Interface, identity string) *fakeReplica {
+	lock, err := resourcelock.New(resourcelock.ConfigMapsResourceLock, "kube-system", leaderElectionLockName, kubeClient.CoreV1(),
+		resourcelock.ResourceLockConfig{Identity: identity, EventRecorder: record.NewFakeRecorder(100)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeReplica{stop: make(chan struct{}), started: make(chan struct{}), stopped: make(chan struct{}), done: make(chan struct{})}
+	config := leaderElectionConfig{leaseDuration: time.Second, renewDeadline: 300 * time.Millisecond, retryPeriod: 50 * time.Millisecond}
+	run := func(stop <-chan struct{}) {
+		close(r.started)
+		<-stop
+		close(r.stopped)
+	}
+	go func() {
+		r.err = runWithLeaderElection(lock, config, run, r.stop)
+		close(r.done)
+	}()
+	return r
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func waitClosed(t *testing.T, ch chan struct{}, what string) {
+	select {
+	case <-ch:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Timed out waiting for %s", what)
+	}
+}
+
+func TestRunWithLeaderElection(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+
+	a := startFakeReplica(t, kubeClient, "a")
+	waitClosed(t, a.started, "a to lead")
+	b := startFakeReplica(t, kubeClient, "b")
+	time.Sleep(200 * time.Millisecond)
+	if isClosed(b.started) {
+		t.Fatalf("Expected b to be on standby")
+	}
+
+	// b takes the lock over: a stops, b leads
+	lock, err := resourcelock.New(resourcelock.ConfigMapsResourceLock, "kube-system", leaderElectionLockName, kubeClient.CoreV1(),
+		resourcelock.ResourceLockConfig{Identity: "b", EventRecorder: record.NewFakeRecorder(100)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for !isClosed(a.done) {
+		now := metav1.Now()
+		if _, err := lock.Get(); err == nil {
+			lock.Update(resourcelock.LeaderElectionRecord{HolderIdentity: "b", LeaseDurationSeconds: 60, AcquireTime: now, RenewTime: now})
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if a.err == nil {
+		t.Errorf("Expected error after losing the lock")
+	}
+	if !isClosed(a.stopped) {
+		t.Errorf("Expected a to have stopped")
+	}
+	waitClosed(t, b.started, "b to lead")
+
+	close(b.stop)
+	waitClosed(t, b.done, "b to stop")
+	if b.err != nil {
+		t.Errorf("Unexpected error %v", b.err)
+	}
+	if !isClosed(b.stopped) {
+		t.Errorf("Expected b to have stopped")
+	}
+}
@@ -1,8 +1,8 @@
 package main
 
 import (
+	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -11,19 +11,60 @@ import (
 	"github.com/spf13/pflag"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/helm/pkg/chartutil"
 	"k8s.io/helm/pkg/helm"
 	"k8s.io/helm/pkg/helm/environment"
 
 	helmClientset "github.com/bitnami-labs/helm-crd/pkg/client/clientset/versioned"
+	chartUtils "github.com/bitnami-labs/helm-crd/pkg/utils/chart"
 )
 
 var (
-	settings environment.EnvSettings
+	settings            environment.EnvSettings
+	resyncPeriod        time.Duration
+	authSecretAllowlist []string
+	defaultRepository   string
+	indexMaxAge         time.Duration
+	chartCacheSize      int64
+	versionPollInterval time.Duration
+	localChartDir       string
+	workers             int
+	maxTillerOperations int
+	leaderElect         bool
+	leaderElection      leaderElectionConfig
+	leaderIdentity      string
+	namespaces          []string
+	labelSelector       string
+	metricsAddr         string
+	healthAddr          string
+	tillerPingPeriod    time.Duration
+	stuckWorkerTimeout  time.Duration
 )
 
 func init() {
 	settings.AddFlags(pflag.CommandLine)
+	pflag.StringVar(&metricsAddr, "metrics-addr", ":8080", "address Prometheus metrics are served on, at /metrics (empty to disable)")
+	pflag.StringVar(&healthAddr, "health-addr", ":8081", "address the liveness (/healthz) and readiness (/readyz) probes are served on (empty to disable)")
+	pflag.DurationVar(&tillerPingPeriod, "tiller-ping-period", defaultTillerPingPeriod, "interval between pings of Tiller, which must be reachable for the controller to be ready")
+	pflag.DurationVar(&stuckWorkerTimeout, "stuck-worker-timeout", defaultStuckWorkerTimeout, "duration a worker may reconcile a single HelmRelease before the controller is no longer live (0 to disable)")
+	pflag.IntVar(&workers, "workers", defaultWorkers, "number of HelmReleases reconciled concurrently")
+	pflag.IntVar(&maxTillerOperations, "max-tiller-operations", 0, "maximum number of install, upgrade and rollback calls to Tiller running at once (0 for no limit other than --workers)")
+	pflag.StringSliceVar(&namespaces, "namespaces", nil, "namespaces whose HelmReleases are reconciled (all namespaces if empty). ClusterHelmRepositories are not available when set.")
+	pflag.StringVar(&labelSelector, "label-selector", "", "label selector of the HelmReleases reconciled (eg: shard=a), other HelmReleases are ignored")
+	pflag.BoolVar(&leaderElect, "leader-elect", false, "only reconcile HelmReleases while holding a leader election lock, a ConfigMap in the POD_NAMESPACE namespace, so that several replicas can run")
+	pflag.DurationVar(&leaderElection.leaseDuration, "leader-elect-lease-duration", 15*time.Second, "duration standby replicas wait before taking over the leader election lock of a leader that stopped renewing it")
+	pflag.DurationVar(&leaderElection.renewDeadline, "leader-elect-renew-deadline", 10*time.Second, "duration the leader retries renewing its lock before giving it up, and stopping")
+	pflag.DurationVar(&leaderElection.retryPeriod, "leader-elect-retry-period", 2*time.Second, "interval between attempts to acquire or renew the leader election lock")
+	pflag.StringVar(&leaderIdentity, "leader-elect-identity", "", "identity of this replica in leader election (defaults to the hostname)")
+	pflag.DurationVar(&resyncPeriod, "resync-period", 10*time.Minute, "interval between checks of deployed releases for drift (0 to disable)")
+	pflag.DurationVar(&indexMaxAge, "index-max-age", defaultIndexMaxAge, "maximum age of cached repository indexes, older ones are revalidated with the repository (0 to revalidate on every use)")
+	pflag.DurationVar(&versionPollInterval, "version-poll-interval", defaultVersionPoll, "interval between checks for newer chart versions matching the version range of HelmReleases, or new commits of their git branch (0 to disable automatic upgrades)")
+	pflag.Int64Var(&chartCacheSize, "chart-cache-size", 256<<20, "maximum size in bytes of the downloaded charts kept in the helm home (0 to disable)")
+	pflag.StringVar(&localChartDir, "local-chart-dir", "", "directory (eg: a mounted volume) file:// chart and repository URLs are read from (file URLs are disabled if empty)")
+	pflag.StringVar(&defaultRepository, "default-repository", "", "ClusterHelmRepository used by HelmReleases without repoUrl nor repository (defaults to "+defaultRepoURL+")")
+	pflag.StringSliceVar(&authSecretAllowlist, "auth-secret-allowlist", nil, "secrets (and CA configmaps) HelmReleases may use for repository auth outside of their namespace, as [<release namespace>:]<secret namespace>/<secret name> (\"*\" matches any release namespace or secret name)")
 }
 
 func main2() error {
@@ -43,24 +84,105 @@ func main2() error {
 	}
 
 	log.Printf("Using tiller host: %s", settings.TillerHost)
-	helmClient := helm.NewClient(helm.Host(settings.TillerHost))
+	helmClient := newMetricsHelmClient(helm.NewClient(helm.Host(settings.TillerHost)))
 
-	netClient := &http.Client{
-		Timeout: time.Second * defaultTimeoutSeconds,
+	// Client for repositories without custom TLS settings
+	netClient := chartUtils.NewHTTPClient(time.Second*defaultTimeoutSeconds, nil)
+
+	allowlist, err := parseSecretAllowlist(authSecretAllowlist)
+	if err != nil {
+		return err
 	}
 
-	controller := NewController(clientset, kubeClient, helmClient, netClient, chartutil.LoadArchive)
+	watch, err := parseWatchOptions(namespaces, labelSelector)
+	if err != nil {
+		return err
+	}
+	if !watch.allNamespaces() && defaultRepository != "" {
+		return fmt.Errorf("--default-repository can't be used with --namespaces")
+	}
 
-	stop := make(chan struct{})
-	defer close(stop)
+	controller := NewController(clientset, kubeClient, helmClient, netClient, chartutil.LoadArchive, resyncPeriod, watch)
+	controller.secretAllowlist = allowlist
+	controller.defaultRepository = defaultRepository
+	controller.indexCache = newIndexCache(indexMaxAge)
+	controller.versionPollInterval = versionPollInterval
+	controller.localChartDir = localChartDir
+	if workers < 1 {
+		return fmt.Errorf("--workers must be at least 1")
+	}
+	controller.workers = workers
+	if maxTillerOperations > 0 {
+		controller.tillerOperations = make(chan struct{}, maxTillerOperations)
+	}
+	if controller.gitCache, err = chartUtils.NewGitCache(settings.Home.Path("git"), time.Second*defaultTimeoutSeconds); err != nil {
+		return err
+	}
+	if chartCacheSize > 0 {
+		if controller.archiveCache, err = chartUtils.NewArchiveCache(settings.Home.Archive(), chartCacheSize); err != nil {
+			return err
+		}
+	}
 
-	go controller.Run(stop)
+	if metricsAddr != "" {
+		if err := serveMetrics(metricsAddr); err != nil {
+			return err
+		}
+		log.Printf("Serving metrics on %s/metrics", metricsAddr)
+	}
 
-	sigterm := make(chan os.Signal, 1)
-	signal.Notify(sigterm, syscall.SIGTERM)
-	<-sigterm
+	stop := make(chan struct{})
+	go func() {
+		sigterm := make(chan os.Signal, 1)
+		signal.Notify(sigterm, syscall.SIGTERM)
+		<-sigterm
+		close(stop)
+	}()
+
+	if tillerPingPeriod <= 0 {
+		return fmt.Errorf("--tiller-ping-period must be positive")
+	}
+	health := newHealthChecks(controller, tillerPingPeriod, stuckWorkerTimeout)
+	go health.run(stop)
+	if healthAddr != "" {
+		if err := serveHTTP(healthAddr, health.handler()); err != nil {
+			return err
+		}
+		log.Printf("Serving probes on %s/healthz and %s/readyz", healthAddr, healthAddr)
+	}
+	run := func(stop <-chan struct{}) {
+		health.setLeading()
+		controller.Run(stop)
+	}
 
-	return nil
+	if !leaderElect {
+		run(stop)
+		return nil
+	}
+	lock, err := leaderElectionLock(kubeClient, controller.recorder)
+	if err != nil {
+		return err
+	}
+	return runWithLeaderElection(lock, leaderElection, run, stop)
+}
+
+// leaderElectionLock returns the leader election lock, a ConfigMap in
+// the POD_NAMESPACE namespace
+func leaderElectionLock(kubeClient kubernetes.Interface, recorder record.EventRecorder) (resourcelock.Interface, error) {
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		return nil, fmt.Errorf("POD_NAMESPACE must be set for leader election")
+	}
+	identity := leaderIdentity
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		identity = hostname
+	}
+	return resourcelock.New(resourcelock.ConfigMapsResourceLock, namespace, leaderElectionLockName, kubeClient.CoreV1(),
+		resourcelock.ResourceLockConfig{Identity: identity, EventRecorder: recorder})
 }
 
 func main() {
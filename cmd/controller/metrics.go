@@ -0,0 +1,346 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/helm/pkg/helm"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/proto/hapi/release"
+	rls "k8s.io/helm/pkg/proto/hapi/services"
+
+	helmCrdV1 "github.com/bitnami-labs/helm-crd/pkg/apis/helm.bitnami.com/v1"
+	chartUtils "github.com/bitnami-labs/helm-crd/pkg/utils/chart"
+)
+
+const (
+	metricsNamespace = "helm_crd"
+	// Result of successful reconciles, failed ones are labelled with
+	// their reason
+	resultSuccess = "Success"
+	// Kinds of repository downloads
+	downloadIndex = "index"
+	downloadChart = "chart"
+)
+
+var (
+	reconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "reconcile_total",
+		Help:      "Number of HelmRelease reconciles, by result.",
+	}, []string{"result"})
+	reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Duration of HelmRelease reconciles, by result.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 15),
+	}, []string{"result"})
+
+	workqueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "depth",
+		Help:      "Number of items waiting in a workqueue.",
+	}, []string{"name"})
+	workqueueAdds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "adds_total",
+		Help:      "Number of items added to a workqueue.",
+	}, []string{"name"})
+	workqueueRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "retries_total",
+		Help:      "Number of items added back to a workqueue after an error.",
+	}, []string{"name"})
+	workqueueLatency = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "queue_latency_microseconds",
+		Help:      "Time items spend in a workqueue before being processed.",
+	}, []string{"name"})
+	workqueueWorkDuration = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "work_duration_microseconds",
+		Help:      "Time spent processing workqueue items.",
+	}, []string{"name"})
+
+	repositoryDownloadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "repository_download_duration_seconds",
+		Help:      "Duration of repository index and chart downloads, by repository host.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"host", "kind"})
+	repositoryDownloadErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "repository_download_errors_total",
+		Help:      "Number of failed repository index and chart downloads, by repository host.",
+	}, []string{"host", "kind"})
+
+	tillerRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "tiller_request_duration_seconds",
+		Help:      "Duration of Tiller RPCs, by method.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 15),
+	}, []string{"method"})
+	tillerRequestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "tiller_request_errors_total",
+		Help:      "Number of failed Tiller RPCs, by method.",
+	}, []string{"method"})
+
+	releaseStatus = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "release_status",
+		Help:      "Tiller status code of the release of a HelmRelease (1 is DEPLOYED, 4 is FAILED, see hapi.release.Status).",
+	}, []string{"namespace", "name"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		reconcileTotal,
+		reconcileDuration,
+		workqueueDepth,
+		workqueueAdds,
+		workqueueRetries,
+		workqueueLatency,
+		workqueueWorkDuration,
+		repositoryDownloadDuration,
+		repositoryDownloadErrors,
+		tillerRequestDuration,
+		tillerRequestErrors,
+		releaseStatus,
+	)
+	// Queues get their metrics when created, the provider must be set
+	// before
+	workqueue.SetProvider(workqueueMetricsProvider{})
+}
+
+// serveMetrics serves the Prometheus metrics on /metrics at addr
+func serveMetrics(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return serveHTTP(addr, mux)
+}
+
+// serveHTTP listens on addr, and serves handler in the background
+func serveHTTP(addr string, handler http.Handler) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go http.Serve(listener, handler)
+	return nil
+}
+
+// observeReconcile records a reconcile that started at start and
+// returned err
+func observeReconcile(start time.Time, err error) {
+	result := resultSuccess
+	if err != nil {
+		result = errorReason(err)
+	}
+	reconcileTotal.WithLabelValues(result).Inc()
+	reconcileDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// setReleaseStatusMetric records the Tiller status code of the release
+// of helmObj
+func setReleaseStatusMetric(helmObj *helmCrdV1.HelmRelease, code release.Status_Code) {
+	releaseStatus.WithLabelValues(helmObj.Namespace, helmObj.Name).Set(float64(code))
+}
+
+// deleteReleaseStatusMetric forgets the Tiller status code of the
+// release of the HelmRelease with the given key
+func deleteReleaseStatusMetric(key string) {
+	if namespace, name, err := cache.SplitMetaNamespaceKey(key); err == nil {
+		releaseStatus.DeleteLabelValues(namespace, name)
+	}
+}
+
+// repositoryHost returns the host of a repository URL, or its scheme
+// if it has no host (eg: file:///charts)
+func repositoryHost(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return ""
+	}
+	if u.Host == "" {
+		return u.Scheme
+	}
+	return u.Host
+}
+
+// observeDownload records a repository download of the given kind
+func observeDownload(kind, host string, duration time.Duration, err error) {
+	repositoryDownloadDuration.WithLabelValues(host, kind).Observe(duration.Seconds())
+	if err != nil {
+		repositoryDownloadErrors.WithLabelValues(host, kind).Inc()
+	}
+}
+
+// observeIndexDownload records an index download of an IndexCache
+func observeIndexDownload(indexURL string, duration time.Duration, err error) {
+	observeDownload(downloadIndex, repositoryHost(indexURL), duration, err)
+}
+
+// newIndexCache returns an IndexCache recording its downloads
+func newIndexCache(maxAge time.Duration) *chartUtils.IndexCache {
+	indexCache := chartUtils.NewIndexCache(maxAge)
+	indexCache.OnDownload = observeIndexDownload
+	return indexCache
+}
+
+// metricsGetter is a Getter recording chart downloads. Cache hits of
+// the archive cache don't reach it.
+type metricsGetter struct {
+	chartUtils.Getter
+}
+
+func (g metricsGetter) Get(rawURL, authHeader string) ([]byte, error) {
+	start := time.Now()
+	data, err := g.Getter.Get(rawURL, authHeader)
+	observeDownload(downloadChart, repositoryHost(rawURL), time.Since(start), err)
+	return data, err
+}
+
+// workqueueMetricsProvider provides the metrics of named workqueues
+type workqueueMetricsProvider struct{}
+
+func (workqueueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return workqueueDepth.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return workqueueAdds.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewLatencyMetric(name string) workqueue.SummaryMetric {
+	return workqueueLatency.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewWorkDurationMetric(name string) workqueue.SummaryMetric {
+	return workqueueWorkDuration.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return workqueueRetries.WithLabelValues(name)
+}
+
+// metricsHelmClient is a helm.Interface recording the latency and
+// errors of the Tiller RPCs of another one
+type metricsHelmClient struct {
+	client helm.Interface
+}
+
+var _ helm.Interface = &metricsHelmClient{}
+
+func newMetricsHelmClient(client helm.Interface) helm.Interface {
+	return &metricsHelmClient{client: client}
+}
+
+// observe records an RPC that started at start and returned err
+func (m *metricsHelmClient) observe(method string, start time.Time, err error) {
+	tillerRequestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		tillerRequestErrors.WithLabelValues(method).Inc()
+	}
+}
+
+func (m *metricsHelmClient) ListReleases(opts ...helm.ReleaseListOption) (*rls.ListReleasesResponse, error) {
+	start := time.Now()
+	res, err := m.client.ListReleases(opts...)
+	m.observe("ListReleases", start, err)
+	return res, err
+}
+
+func (m *metricsHelmClient) InstallRelease(chStr, namespace string, opts ...helm.InstallOption) (*rls.InstallReleaseResponse, error) {
+	start := time.Now()
+	res, err := m.client.InstallRelease(chStr, namespace, opts...)
+	m.observe("InstallRelease", start, err)
+	return res, err
+}
+
+func (m *metricsHelmClient) InstallReleaseFromChart(ch *chart.Chart, namespace string, opts ...helm.InstallOption) (*rls.InstallReleaseResponse, error) {
+	start := time.Now()
+	res, err := m.client.InstallReleaseFromChart(ch, namespace, opts...)
+	m.observe("InstallRelease", start, err)
+	return res, err
+}
+
+func (m *metricsHelmClient) DeleteRelease(rlsName string, opts ...helm.DeleteOption) (*rls.UninstallReleaseResponse, error) {
+	start := time.Now()
+	res, err := m.client.DeleteRelease(rlsName, opts...)
+	m.observe("UninstallRelease", start, err)
+	return res, err
+}
+
+func (m *metricsHelmClient) ReleaseStatus(rlsName string, opts ...helm.StatusOption) (*rls.GetReleaseStatusResponse, error) {
+	start := time.Now()
+	res, err := m.client.ReleaseStatus(rlsName, opts...)
+	m.observe("GetReleaseStatus", start, err)
+	return res, err
+}
+
+func (m *metricsHelmClient) UpdateRelease(rlsName, chStr string, opts ...helm.UpdateOption) (*rls.UpdateReleaseResponse, error) {
+	start := time.Now()
+	res, err := m.client.UpdateRelease(rlsName, chStr, opts...)
+	m.observe("UpdateRelease", start, err)
+	return res, err
+}
+
+func (m *metricsHelmClient) UpdateReleaseFromChart(rlsName string, ch *chart.Chart, opts ...helm.UpdateOption) (*rls.UpdateReleaseResponse, error) {
+	start := time.Now()
+	res, err := m.client.UpdateReleaseFromChart(rlsName, ch, opts...)
+	m.observe("UpdateRelease", start, err)
+	return res, err
+}
+
+func (m *metricsHelmClient) RollbackRelease(rlsName string, opts ...helm.RollbackOption) (*rls.RollbackReleaseResponse, error) {
+	start := time.Now()
+	res, err := m.client.RollbackRelease(rlsName, opts...)
+	m.observe("RollbackRelease", start, err)
+	return res, err
+}
+
+func (m *metricsHelmClient) ReleaseContent(rlsName string, opts ...helm.ContentOption) (*rls.GetReleaseContentResponse, error) {
+	start := time.Now()
+	res, err := m.client.ReleaseContent(rlsName, opts...)
+	m.observe("GetReleaseContent", start, err)
+	return res, err
+}
+
+func (m *metricsHelmClient) ReleaseHistory(rlsName string, opts ...helm.HistoryOption) (*rls.GetHistoryResponse, error) {
+	start := time.Now()
+	res, err := m.client.ReleaseHistory(rlsName, opts...)
+	m.observe("GetHistory", start, err)
+	return res, err
+}
+
+func (m *metricsHelmClient) GetVersion(opts ...helm.VersionOption) (*rls.GetVersionResponse, error) {
+	start := time.Now()
+	res, err := m.client.GetVersion(opts...)
+	m.observe("GetVersion", start, err)
+	return res, err
+}
+
+// RunReleaseTest is not recorded, as it streams its results
+func (m *metricsHelmClient) RunReleaseTest(rlsName string, opts ...helm.ReleaseTestOption) (<-chan *rls.TestReleaseResponse, <-chan error) {
+	return m.client.RunReleaseTest(rlsName, opts...)
+}
+
+func (m *metricsHelmClient) PingTiller() error {
+	start := time.Now()
+	err := m.client.PingTiller()
+	m.observe("Ping", start, err)
+	return err
+}
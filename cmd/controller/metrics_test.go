@@ -0,0 +1,157 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/helm/pkg/helm"
+	"k8s.io/helm/pkg/proto/hapi/release"
+
+	helmCrdV1 "github.com/bitnami-labs/helm-crd/pkg/apis/helm.bitnami.com/v1"
+)
+
+// metricValue returns the value of a counter or gauge, or the number
+// of observations of a histogram or summary
+func metricValue(t *testing.T, metric prometheus.Metric) float64 {
+	m := &dto.Metric{}
+	if err := metric.Write(m); err != nil {
+		t.Fatal(err)
+	}
+	switch {
+	case m.Counter != nil:
+		return m.Counter.GetValue()
+	case m.Gauge != nil:
+		return m.Gauge.GetValue()
+	case m.Histogram != nil:
+		return float64(m.Histogram.GetSampleCount())
+	case m.Summary != nil:
+		return float64(m.Summary.GetSampleCount())
+	}
+	t.Fatalf("Unexpected metric %v", m)
+	return 0
+}
+
+func TestRepositoryHost(t *testing.T) {
+	tests := []struct {
+		url, expected string
+	}{
+		{"https://charts.example.com/stable/index.yaml", "charts.example.com"},
+		{"http://localhost:8080/foo-1.0.0.tgz", "localhost:8080"},
+		{"file:///charts/index.yaml", "file"},
+		{"%zz", ""},
+	}
+	for _, tt := range tests {
+		if host := repositoryHost(tt.url); host != tt.expected {
+			t.Errorf("Expected host %q for %s received %q", tt.expected, tt.url, host)
+		}
+	}
+}
+
+func TestWorkqueueMetrics(t *testing.T) {
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "metrics-test")
+	defer queue.ShutDown()
+
+	queue.Add("foo")
+	queue.Add("bar")
+	if depth := metricValue(t, workqueueDepth.WithLabelValues("metrics-test")); depth != 2 {
+		t.Errorf("Expected depth 2 received %v", depth)
+	}
+	key, _ := queue.Get()
+	if depth := metricValue(t, workqueueDepth.WithLabelValues("metrics-test")); depth != 1 {
+		t.Errorf("Expected depth 1 received %v", depth)
+	}
+	queue.AddRateLimited(key)
+	queue.Done(key)
+
+	if adds := metricValue(t, workqueueAdds.WithLabelValues("metrics-test")); adds != 2 {
+		t.Errorf("Expected 2 adds received %v", adds)
+	}
+	if retries := metricValue(t, workqueueRetries.WithLabelValues("metrics-test")); retries != 1 {
+		t.Errorf("Expected 1 retry received %v", retries)
+	}
+	if n := metricValue(t, workqueueLatency.WithLabelValues("metrics-test")); n != 1 {
+		t.Errorf("Expected 1 latency observation received %v", n)
+	}
+	if n := metricValue(t, workqueueWorkDuration.WithLabelValues("metrics-test")); n != 1 {
+		t.Errorf("Expected 1 work duration observation received %v", n)
+	}
+}
+
+func TestReleaseMetrics(t *testing.T) {
+	h := helmCrdV1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "metrics", Name: "foo"},
+		Spec: helmCrdV1.HelmReleaseSpec{
+			RepoURL:   "http://metrics.example.com/repo/",
+			ChartName: "foo",
+			Version:   "1.0.0",
+		},
+	}
+	controller := prepareTestController([]helmCrdV1.HelmRelease{h}, []string{})
+	fakeClient := controller.helmClient.(*helm.FakeClient)
+	controller.helmClient = newMetricsHelmClient(fakeClient)
+
+	counts := func() map[string]float64 {
+		return map[string]float64{
+			"reconciles":     metricValue(t, reconcileTotal.WithLabelValues(resultSuccess)),
+			"durations":      metricValue(t, reconcileDuration.WithLabelValues(resultSuccess)),
+			"installs":       metricValue(t, tillerRequestDuration.WithLabelValues("InstallRelease")),
+			"histories":      metricValue(t, tillerRequestDuration.WithLabelValues("GetHistory")),
+			"indexes":        metricValue(t, repositoryDownloadDuration.WithLabelValues("metrics.example.com", downloadIndex)),
+			"charts":         metricValue(t, repositoryDownloadDuration.WithLabelValues("metrics.example.com", downloadChart)),
+			"chartErrors":    metricValue(t, repositoryDownloadErrors.WithLabelValues("metrics.example.com", downloadChart)),
+			"statusRequests": metricValue(t, tillerRequestDuration.WithLabelValues("GetReleaseStatus")),
+		}
+	}
+	before := counts()
+
+	controller.queue.Add("metrics/foo")
+	controller.processNextItem()
+	after := counts()
+	expected := map[string]float64{
+		"reconciles":     1,
+		"durations":      1,
+		"installs":       1,
+		"histories":      1,
+		"indexes":        1,
+		"charts":         1,
+		"chartErrors":    0,
+		"statusRequests": 1,
+	}
+	for name, n := range expected {
+		if d := after[name] - before[name]; d != n {
+			t.Errorf("Expected %v more %s received %v", n, name, d)
+		}
+	}
+
+	statusErrors := metricValue(t, tillerRequestErrors.WithLabelValues("GetReleaseStatus"))
+	if _, err := controller.helmClient.ReleaseStatus("missing"); err == nil {
+		t.Errorf("Expected error for missing release")
+	}
+	if d := metricValue(t, tillerRequestErrors.WithLabelValues("GetReleaseStatus")) - statusErrors; d != 1 {
+		t.Errorf("Expected 1 more status error received %v", d)
+	}
+
+	// The fake client doesn't set the status of installed releases
+	for _, rel := range fakeClient.Rels {
+		if rel.Name == "metrics-foo" {
+			rel.Info = &release.Info{Status: &release.Status{Code: release.Status_FAILED}}
+		}
+	}
+	helmObj := h.DeepCopy()
+	controller.checkReleaseStatus(helmObj, "metrics-foo", nil)
+	if code := metricValue(t, releaseStatus.WithLabelValues("metrics", "foo")); code != float64(release.Status_FAILED) {
+		t.Errorf("Expected status code %d received %v", release.Status_FAILED, code)
+	}
+
+	// Deleted HelmReleases have no status
+	controller.informer.GetIndexer().Delete(&h)
+	if err := controller.updateRelease("metrics/foo"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if releaseStatus.DeleteLabelValues("metrics", "foo") {
+		t.Errorf("Expected status of deleted HelmRelease to be removed")
+	}
+}
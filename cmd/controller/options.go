@@ -0,0 +1,75 @@
+package main
+
+import (
+	"k8s.io/helm/pkg/helm"
+
+	helmCrdV1 "github.com/bitnami-labs/helm-crd/pkg/apis/helm.bitnami.com/v1"
+)
+
+// Same default as the helm CLI --timeout flag
+const defaultTillerTimeoutSeconds = 300
+
+func tillerTimeout(r *helmCrdV1.HelmRelease) int64 {
+	if r.Spec.Timeout > 0 {
+		return r.Spec.Timeout
+	}
+	return defaultTillerTimeoutSeconds
+}
+
+func installOptions(r *helmCrdV1.HelmRelease, rlsName, values string) []helm.InstallOption {
+	return []helm.InstallOption{
+		helm.ValueOverrides([]byte(values)),
+		helm.ReleaseName(rlsName),
+		helm.InstallTimeout(tillerTimeout(r)),
+		helm.InstallWait(r.Spec.Wait),
+		helm.InstallDisableHooks(r.Spec.DisableHooks),
+	}
+}
+
+func upgradeOptions(r *helmCrdV1.HelmRelease, values string) []helm.UpdateOption {
+	return []helm.UpdateOption{
+		helm.UpdateValueOverrides([]byte(values)),
+		helm.UpgradeTimeout(tillerTimeout(r)),
+		helm.UpgradeWait(r.Spec.Wait),
+		helm.UpgradeDisableHooks(r.Spec.DisableHooks),
+		helm.UpgradeForce(r.Spec.Upgrade.Force),
+		helm.UpgradeRecreate(r.Spec.Upgrade.RecreatePods),
+		helm.ReuseValues(r.Spec.Upgrade.ReuseValues),
+		helm.ResetValues(r.Spec.Upgrade.ResetValues),
+	}
+}
+
+func rollbackOptions(r *helmCrdV1.HelmRelease, revision int32) []helm.RollbackOption {
+	opts := []helm.RollbackOption{
+		helm.RollbackVersion(revision),
+		helm.RollbackTimeout(tillerTimeout(r)),
+		helm.RollbackDisableHooks(r.Spec.DisableHooks),
+	}
+	if rb := r.Spec.Rollback; rb != nil {
+		opts = append(opts,
+			helm.RollbackForce(rb.Force),
+			helm.RollbackRecreate(rb.Recreate),
+			helm.RollbackWait(rb.Wait),
+		)
+	} else {
+		// Rolling back a failed upgrade
+		opts = append(opts,
+			helm.RollbackForce(r.Spec.Upgrade.Force),
+			helm.RollbackRecreate(r.Spec.Upgrade.RecreatePods),
+			helm.RollbackWait(r.Spec.Wait),
+		)
+	}
+	return opts
+}
+
+func deleteOptions(r *helmCrdV1.HelmRelease) []helm.DeleteOption {
+	purge := true
+	if r.Spec.Delete.Purge != nil {
+		purge = *r.Spec.Delete.Purge
+	}
+	return []helm.DeleteOption{
+		helm.DeletePurge(purge),
+		helm.DeleteTimeout(tillerTimeout(r)),
+		helm.DeleteDisableHooks(r.Spec.DisableHooks),
+	}
+}
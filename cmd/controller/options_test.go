@@ -0,0 +1,109 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/helm/pkg/helm"
+
+	helmCrdV1 "github.com/bitnami-labs/helm-crd/pkg/apis/helm.bitnami.com/v1"
+)
+
+// appliedOptions applies helm options to a fake client and returns
+// the resulting (unexported) options struct for inspection
+func appliedOptions(opts ...func(*helm.FakeClient)) reflect.Value {
+	c := &helm.FakeClient{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return reflect.ValueOf(c.Opts)
+}
+
+func withInstallOptions(opts []helm.InstallOption) func(*helm.FakeClient) {
+	return func(c *helm.FakeClient) {
+		for _, o := range opts {
+			c.Option(helm.Option(o))
+		}
+	}
+}
+
+func withUpgradeOptions(opts []helm.UpdateOption) func(*helm.FakeClient) {
+	return func(c *helm.FakeClient) {
+		for _, o := range opts {
+			c.Option(helm.Option(o))
+		}
+	}
+}
+
+func withDeleteOptions(opts []helm.DeleteOption) func(*helm.FakeClient) {
+	return func(c *helm.FakeClient) {
+		for _, o := range opts {
+			c.Option(helm.Option(o))
+		}
+	}
+}
+
+func TestInstallOptions(t *testing.T) {
+	r := &helmCrdV1.HelmRelease{}
+	o := appliedOptions(withInstallOptions(installOptions(r, "foo", "")))
+	if name := o.FieldByName("instReq").FieldByName("Name").String(); name != "foo" {
+		t.Errorf("Expected release name foo received %s", name)
+	}
+	if timeout := o.FieldByName("instReq").FieldByName("Timeout").Int(); timeout != defaultTillerTimeoutSeconds {
+		t.Errorf("Expected default timeout received %d", timeout)
+	}
+
+	r.Spec.Timeout = 60
+	r.Spec.Wait = true
+	r.Spec.DisableHooks = true
+	o = appliedOptions(withInstallOptions(installOptions(r, "foo", "")))
+	if timeout := o.FieldByName("instReq").FieldByName("Timeout").Int(); timeout != 60 {
+		t.Errorf("Expected timeout 60 received %d", timeout)
+	}
+	if !o.FieldByName("instReq").FieldByName("Wait").Bool() {
+		t.Errorf("Expected install to wait")
+	}
+	if !o.FieldByName("disableHooks").Bool() {
+		t.Errorf("Expected hooks to be disabled")
+	}
+}
+
+func TestUpgradeOptions(t *testing.T) {
+	r := &helmCrdV1.HelmRelease{
+		Spec: helmCrdV1.HelmReleaseSpec{
+			Wait: true,
+			Upgrade: helmCrdV1.HelmReleaseUpgrade{
+				Force:        true,
+				RecreatePods: true,
+				ReuseValues:  true,
+			},
+		},
+	}
+	o := appliedOptions(withUpgradeOptions(upgradeOptions(r, "")))
+	for _, f := range []string{"force", "recreate", "reuseValues"} {
+		if !o.FieldByName(f).Bool() {
+			t.Errorf("Expected %s to be set", f)
+		}
+	}
+	if o.FieldByName("resetValues").Bool() {
+		t.Errorf("Unexpected resetValues")
+	}
+	if !o.FieldByName("updateReq").FieldByName("Wait").Bool() {
+		t.Errorf("Expected upgrade to wait")
+	}
+}
+
+func TestDeleteOptions(t *testing.T) {
+	r := &helmCrdV1.HelmRelease{}
+	o := appliedOptions(withDeleteOptions(deleteOptions(r)))
+	if !o.FieldByName("uninstallReq").FieldByName("Purge").Bool() {
+		t.Errorf("Expected releases to be purged by default")
+	}
+
+	purge := false
+	r.Spec.Delete.Purge = &purge
+	o = appliedOptions(withDeleteOptions(deleteOptions(r)))
+	if o.FieldByName("uninstallReq").FieldByName("Purge").Bool() {
+		t.Errorf("Expected release not to be purged")
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/helm/pkg/repo"
+
+	helmCrdV1 "github.com/bitnami-labs/helm-crd/pkg/apis/helm.bitnami.com/v1"
+	chartUtils "github.com/bitnami-labs/helm-crd/pkg/utils/chart"
+)
+
+const (
+	helmRepositoryKind        = "HelmRepository"
+	clusterHelmRepositoryKind = "ClusterHelmRepository"
+
+	// Index of HelmReleases by the repository they reference
+	repositoryIndex = "repository"
+
+	defaultRefreshInterval = 10 * time.Minute
+)
+
+// repositoryKey returns the key of a HelmRepository (or of a
+// ClusterHelmRepository, with an empty namespace) in the repository
+// work queue, e.g. HelmRepository/myns/name
+func repositoryKey(kind, namespace, name string) string {
+	if namespace == "" {
+		return kind + "/" + name
+	}
+	return kind + "/" + namespace + "/" + name
+}
+
+// splitRepositoryKey returns the kind of a repository key, and its
+// key in the informer store of that kind
+func splitRepositoryKey(key string) (kind, storeKey string) {
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) != 2 {
+		return "", key
+	}
+	return parts[0], parts[1]
+}
+
+// releaseRepositoryKey returns the key of the repository referenced
+// by helmObj, or "" if it references none
+func releaseRepositoryKey(helmObj *helmCrdV1.HelmRelease) (string, error) {
+	ref := helmObj.Spec.Repository
+	if ref == nil {
+		return "", nil
+	}
+	if ref.Name == "" {
+		return "", fmt.Errorf("repository.name must be set")
+	}
+	switch ref.Kind {
+	case "", helmRepositoryKind:
+		return repositoryKey(helmRepositoryKind, helmObj.Namespace, ref.Name), nil
+	case clusterHelmRepositoryKind:
+		return repositoryKey(clusterHelmRepositoryKind, "", ref.Name), nil
+	}
+	return "", fmt.Errorf("unknown repository kind %q, expected %s or %s", ref.Kind, helmRepositoryKind, clusterHelmRepositoryKind)
+}
+
+func repositoryIndexFunc(obj interface{}) ([]string, error) {
+	helmObj, ok := obj.(*helmCrdV1.HelmRelease)
+	if !ok {
+		return nil, nil
+	}
+	key, err := releaseRepositoryKey(helmObj)
+	if err != nil || key == "" {
+		return nil, nil
+	}
+	return []string{key}, nil
+}
+
+// chartRepository is the chart repository a HelmRelease installs from
+type chartRepository struct {
+	// key of the HelmRepository or ClusterHelmRepository, "" if the
+	// repository is given inline in the HelmRelease
+	key string
+	// namespace Secrets are resolved in, "" for a ClusterHelmRepository
+	namespace string
+	url       string
+	// mirrors of url, tried in order when its index can't be fetched
+	mirrors []string
+	auth    *helmCrdV1.HelmReleaseAuth
+}
+
+// indexURL returns the URL of the index of the repository at repoURL
+func indexURL(repoURL string) string {
+	return strings.TrimSuffix(strings.TrimSpace(repoURL), "/") + "/index.yaml"
+}
+
+// fetchIndex fetches the index of the repository with fetch, from its
+// URL or else from its mirrors, and returns the URL of the index it
+// was fetched from
+func (r *chartRepository) fetchIndex(fetch func(indexURL string) (*repo.IndexFile, error)) (*repo.IndexFile, string, error) {
+	var errs []string
+	for _, repoURL := range append([]string{r.url}, r.mirrors...) {
+		u := indexURL(repoURL)
+		index, err := fetch(u)
+		if err == nil {
+			if len(errs) > 0 {
+				log.Printf("Fetched index of %s from mirror %s", r.url, repoURL)
+			}
+			return index, u, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return nil, "", fmt.Errorf("%s", strings.Join(errs, "; "))
+}
+
+// repositoryObject returns the spec, status and metadata of a
+// HelmRepository or ClusterHelmRepository
+func repositoryObject(obj interface{}) (spec *helmCrdV1.HelmRepositorySpec, status *helmCrdV1.HelmRepositoryStatus, meta *metav1.ObjectMeta) {
+	switch r := obj.(type) {
+	case *helmCrdV1.HelmRepository:
+		return &r.Spec, &r.Status, &r.ObjectMeta
+	case *helmCrdV1.ClusterHelmRepository:
+		return &r.Spec, &r.Status, &r.ObjectMeta
+	}
+	return nil, nil, nil
+}
+
+// getRepository returns the HelmRepository or ClusterHelmRepository
+// with the given repository key from the informer caches
+func (c *Controller) getRepository(key string) (interface{}, bool, error) {
+	kind, storeKey := splitRepositoryKey(key)
+	switch kind {
+	case helmRepositoryKind:
+		return c.repositoryInformer.GetIndexer().GetByKey(storeKey)
+	case clusterHelmRepositoryKind:
+		if c.clusterRepositoryInformer == nil {
+			return nil, false, fmt.Errorf("%ss are not available when only some namespaces are watched", clusterHelmRepositoryKind)
+		}
+		return c.clusterRepositoryInformer.GetIndexer().GetByKey(storeKey)
+	}
+	return nil, false, fmt.Errorf("invalid repository key %q", key)
+}
+
+// chartRepository returns the chart repository helmObj installs from:
+// the referenced HelmRepository or ClusterHelmRepository, the default
+// repository, or the inline repoUrl and auth.
+func (c *Controller) chartRepository(helmObj *helmCrdV1.HelmRelease) (*chartRepository, error) {
+	key, err := releaseRepositoryKey(helmObj)
+	if err != nil {
+		return nil, withReason(reasonRepositoryNotFound, err)
+	}
+	// A chartRef names its registry, only its own credentials are used
+	if key == "" && helmObj.Spec.RepoURL == "" && helmObj.Spec.ChartRef == "" && c.defaultRepository != "" {
+		key = repositoryKey(clusterHelmRepositoryKind, "", c.defaultRepository)
+	}
+	if key == "" {
+		url := helmObj.Spec.RepoURL
+		if url == "" {
+			url = defaultRepoURL
+		}
+		return &chartRepository{namespace: helmObj.Namespace, url: url, mirrors: helmObj.Spec.Mirrors, auth: &helmObj.Spec.Auth}, nil
+	}
+
+	obj, exists, err := c.getRepository(key)
+	if err != nil {
+		return nil, withReason(reasonRepositoryNotFound, err)
+	}
+	if !exists {
+		return nil, withReason(reasonRepositoryNotFound, fmt.Errorf("%s not found", key))
+	}
+	spec, _, meta := repositoryObject(obj)
+	return &chartRepository{
+		key:       key,
+		namespace: meta.Namespace,
+		url:       spec.URL,
+		mirrors:   spec.Mirrors,
+		auth:      &spec.Auth,
+	}, nil
+}
+
+// cachedIndex is the last index fetched for a repository
+type cachedIndex struct {
+	url string
+	// indexURL the index was fetched from, of the repository or of a mirror
+	indexURL string
+	index    *repo.IndexFile
+}
+
+// repositoryIndexes caches the index of HelmRepositories and
+// ClusterHelmRepositories, by repository key
+type repositoryIndexes struct {
+	sync.RWMutex
+	indexes map[string]cachedIndex
+}
+
+// get returns the cached index of a repository and the URL it was
+// fetched from, unless the repository had a different URL
+func (r *repositoryIndexes) get(key, url string) (*repo.IndexFile, string) {
+	r.RLock()
+	defer r.RUnlock()
+	if cached, ok := r.indexes[key]; ok && cached.url == url {
+		return cached.index, cached.indexURL
+	}
+	return nil, ""
+}
+
+func (r *repositoryIndexes) set(key, url, indexURL string, index *repo.IndexFile) {
+	r.Lock()
+	defer r.Unlock()
+	if r.indexes == nil {
+		r.indexes = map[string]cachedIndex{}
+	}
+	r.indexes[key] = cachedIndex{url: url, indexURL: indexURL, index: index}
+}
+
+func (r *repositoryIndexes) delete(key string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.indexes, key)
+}
+
+// repositoryIndex returns the index of repo, from the cache kept up
+// to date by syncRepository if it is a HelmRepository or
+// ClusterHelmRepository, or from the index cache otherwise. It also
+// returns the URL of the index, which chart URLs are relative to.
+func (c *Controller) repositoryIndex(r *chartRepository, getter chartUtils.Getter, authHeader, tlsIdentity string) (*repo.IndexFile, string, error) {
+	if r.key != "" {
+		if index, indexURL := c.repoIndexes.get(r.key, r.url); index != nil {
+			return index, indexURL, nil
+		}
+	}
+	index, indexURL, err := r.fetchIndex(func(indexURL string) (*repo.IndexFile, error) {
+		return c.indexCache.Fetch(getter, indexURL, authHeader, tlsIdentity)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if r.key != "" {
+		c.repoIndexes.set(r.key, r.url, indexURL, index)
+	}
+	return index, indexURL, nil
+}
+
+// repositoryHandler returns the event handler of the informer for the
+// given kind of repository
+func (c *Controller) repositoryHandler(kind string) cache.ResourceEventHandlerFuncs {
+	key := func(obj interface{}) (string, bool) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		_, _, meta := repositoryObject(obj)
+		if meta == nil {
+			return "", false
+		}
+		return repositoryKey(kind, meta.Namespace, meta.Name), true
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			// HelmReleases may have been created before their repository
+			if k, ok := key(obj); ok {
+				c.repoQueue.Add(k)
+				c.enqueueRepositoryReleases(k)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldSpec, _, _ := repositoryObject(oldObj)
+			newSpec, _, _ := repositoryObject(newObj)
+			if oldSpec == nil || newSpec == nil || apiequality.Semantic.DeepEqual(oldSpec, newSpec) {
+				// Status updates, refreshes are scheduled by syncRepository
+				return
+			}
+			if k, ok := key(newObj); ok {
+				c.repoQueue.Add(k)
+				c.enqueueRepositoryReleases(k)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if k, ok := key(obj); ok {
+				c.repoQueue.Add(k)
+				c.enqueueRepositoryReleases(k)
+			}
+		},
+	}
+}
+
+// enqueueRepositoryReleases enqueues the HelmReleases referencing the
+// repository with the given key
+func (c *Controller) enqueueRepositoryReleases(key string) {
+	objs, err := c.informer.GetIndexer().ByIndex(repositoryIndex, key)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, obj := range objs {
+		if k, err := cache.MetaNamespaceKeyFunc(obj); err == nil {
+			c.queue.Add(k)
+		}
+	}
+}
+
+func (c *Controller) runRepositoryWorker() {
+	for c.processNextRepository() {
+		// continue looping
+	}
+}
+
+func (c *Controller) processNextRepository() bool {
+	key, quit := c.repoQueue.Get()
+	if quit {
+		return false
+	}
+
+	defer c.repoQueue.Done(key)
+	err := c.syncRepository(key.(string))
+	if err == nil {
+		c.repoQueue.Forget(key)
+	} else if c.repoQueue.NumRequeues(key) < maxRetries {
+		log.Printf("Error fetching repository %s, will retry: %v", key, err)
+		c.repoQueue.AddRateLimited(key)
+	} else {
+		// Retried on the next refresh
+		log.Printf("Error fetching repository %s, giving up: %v", key, err)
+		c.repoQueue.Forget(key)
+		utilruntime.HandleError(err)
+	}
+
+	return true
+}
+
+// syncRepository fetches the index of a HelmRepository or
+// ClusterHelmRepository into the cache, records the outcome in its
+// status and schedules the next refresh.
+func (c *Controller) syncRepository(key string) error {
+	obj, exists, err := c.getRepository(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		log.Printf("Repository %s deleted, dropping its index", key)
+		c.repoIndexes.delete(key)
+		return nil
+	}
+
+	spec, status, meta := repositoryObject(obj)
+	interval := defaultRefreshInterval
+	if spec.RefreshInterval != nil && spec.RefreshInterval.Duration > 0 {
+		interval = spec.RefreshInterval.Duration
+	}
+	defer c.repoQueue.AddAfter(key, interval)
+
+	r := &chartRepository{key: key, namespace: meta.Namespace, url: spec.URL, mirrors: spec.Mirrors, auth: &spec.Auth}
+	newStatus := status.DeepCopy()
+	newStatus.ObservedGeneration = meta.Generation
+	index, indexURL, err := c.fetchRepositoryIndex(r)
+	if err != nil {
+		newStatus.LastError = err.Error()
+		setRepositoryCondition(newStatus, helmCrdV1.HelmRepositoryReady, corev1.ConditionFalse, errorReason(err), err.Error())
+	} else {
+		c.repoIndexes.set(key, spec.URL, indexURL, index)
+		now := metav1.Now()
+		newStatus.LastFetchTime = &now
+		newStatus.LastError = ""
+		newStatus.URL = strings.TrimSuffix(indexURL, "/index.yaml")
+		newStatus.Charts = int32(len(index.Entries))
+		setRepositoryCondition(newStatus, helmCrdV1.HelmRepositoryReady, corev1.ConditionTrue, reasonIndexFetched, fmt.Sprintf("Fetched index with %d charts from %s", newStatus.Charts, newStatus.URL))
+	}
+
+	if statusErr := c.updateRepositoryStatus(obj, newStatus); statusErr != nil {
+		log.Printf("Error updating status of %s due to: %v", key, statusErr)
+		if err == nil {
+			err = statusErr
+		}
+	}
+	return err
+}
+
+// fetchRepositoryIndex fetches the index of r, from its URL or else
+// from its mirrors, and returns the URL it was fetched from
+func (c *Controller) fetchRepositoryIndex(r *chartRepository) (*repo.IndexFile, string, error) {
+	authHeader, err := c.authHeader(r.namespace, r.auth)
+	if err != nil {
+		return nil, "", err
+	}
+	netClient, tlsIdentity, err := c.httpClient(r.namespace, r.auth)
+	if err != nil {
+		return nil, "", err
+	}
+	getters := c.getters(netClient)
+	index, indexURL, err := r.fetchIndex(func(indexURL string) (*repo.IndexFile, error) {
+		log.Printf("Refreshing repo %s index...", indexURL)
+		return c.indexCache.Refresh(getters, indexURL, authHeader, tlsIdentity)
+	})
+	if err != nil {
+		return nil, "", withReason(reasonRepoIndexFetchFailed, err)
+	}
+	return index, indexURL, nil
+}
+
+func (c *Controller) updateRepositoryStatus(obj interface{}, status *helmCrdV1.HelmRepositoryStatus) error {
+	var err error
+	switch r := obj.(type) {
+	case *helmCrdV1.HelmRepository:
+		r = r.DeepCopy()
+		r.Status = *status
+		_, err = c.helmReleaseClient.HelmV1().HelmRepositories(r.Namespace).UpdateStatus(r)
+	case *helmCrdV1.ClusterHelmRepository:
+		r = r.DeepCopy()
+		r.Status = *status
+		_, err = c.helmReleaseClient.HelmV1().ClusterHelmRepositories().UpdateStatus(r)
+	default:
+		err = fmt.Errorf("unexpected repository object %T", obj)
+	}
+	return err
+}
+
+// setRepositoryCondition adds or updates a repository condition.
+// LastTransitionTime is only changed when the condition status changes.
+func setRepositoryCondition(status *helmCrdV1.HelmRepositoryStatus, condType helmCrdV1.HelmRepositoryConditionType, condStatus corev1.ConditionStatus, reason, message string) {
+	var cond *helmCrdV1.HelmRepositoryCondition
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == condType {
+			cond = &status.Conditions[i]
+		}
+	}
+	if cond == nil {
+		status.Conditions = append(status.Conditions, helmCrdV1.HelmRepositoryCondition{Type: condType})
+		cond = &status.Conditions[len(status.Conditions)-1]
+	}
+	if cond.Status != condStatus {
+		cond.Status = condStatus
+		cond.LastTransitionTime = metav1.Now()
+	}
+	cond.Reason = reason
+	cond.Message = message
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/helm/pkg/chartutil"
+
+	helmCrdV1 "github.com/bitnami-labs/helm-crd/pkg/apis/helm.bitnami.com/v1"
+)
+
+const (
+	// Index of HelmReleases by the ConfigMaps and Secrets they take values from
+	valuesFromIndex = "valuesFrom"
+
+	configMapKind = "ConfigMap"
+	secretKind    = "Secret"
+)
+
+func valuesFromIndexKey(kind, namespace, name string) string {
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
+
+// valuesFromIndexFunc indexes HelmReleases by the objects referenced
+// in spec.valuesFrom
+func valuesFromIndexFunc(obj interface{}) ([]string, error) {
+	helmObj, ok := obj.(*helmCrdV1.HelmRelease)
+	if !ok {
+		return nil, nil
+	}
+	var keys []string
+	for _, src := range helmObj.Spec.ValuesFrom {
+		if src.ConfigMapKeyRef != nil {
+			keys = append(keys, valuesFromIndexKey(configMapKind, helmObj.Namespace, src.ConfigMapKeyRef.Name))
+		}
+		if src.SecretKeyRef != nil {
+			keys = append(keys, valuesFromIndexKey(secretKind, helmObj.Namespace, src.SecretKeyRef.Name))
+		}
+	}
+	return keys, nil
+}
+
+func isOptional(optional *bool) bool {
+	return optional != nil && *optional
+}
+
+// valuesSourceData returns the data referenced by a valuesFrom entry,
+// from the ConfigMaps and Secrets watched to trigger upgrades. found is
+// false when an optional reference does not exist.
+func (c *Controller) valuesSourceData(namespace string, src helmCrdV1.HelmReleaseValuesSource) (data []byte, found bool, err error) {
+	switch {
+	case src.ConfigMapKeyRef != nil:
+		ref := src.ConfigMapKeyRef
+		obj, exists, err := c.configMapInformer.GetIndexer().GetByKey(namespace + "/" + ref.Name)
+		if err != nil {
+			return nil, false, err
+		}
+		if !exists {
+			if isOptional(ref.Optional) {
+				return nil, false, nil
+			}
+			return nil, false, fmt.Errorf("ConfigMap %s/%s not found", namespace, ref.Name)
+		}
+		value, ok := obj.(*corev1.ConfigMap).Data[ref.Key]
+		if !ok {
+			if isOptional(ref.Optional) {
+				return nil, false, nil
+			}
+			return nil, false, fmt.Errorf("key %q not found in ConfigMap %s/%s", ref.Key, namespace, ref.Name)
+		}
+		return []byte(value), true, nil
+
+	case src.SecretKeyRef != nil:
+		ref := src.SecretKeyRef
+		obj, exists, err := c.secretInformer.GetIndexer().GetByKey(namespace + "/" + ref.Name)
+		if err != nil {
+			return nil, false, err
+		}
+		if !exists {
+			if isOptional(ref.Optional) {
+				return nil, false, nil
+			}
+			return nil, false, fmt.Errorf("Secret %s/%s not found", namespace, ref.Name)
+		}
+		value, ok := obj.(*corev1.Secret).Data[ref.Key]
+		if !ok {
+			if isOptional(ref.Optional) {
+				return nil, false, nil
+			}
+			return nil, false, fmt.Errorf("key %q not found in Secret %s/%s", ref.Key, namespace, ref.Name)
+		}
+		return value, true, nil
+	}
+	return nil, false, fmt.Errorf("valuesFrom entries must set configMapKeyRef or secretKeyRef")
+}
+
+// releaseValues returns the YAML values to install the release with:
+// every valuesFrom source merged in order, then values and finally
+// valuesObject.
+func (c *Controller) releaseValues(helmObj *helmCrdV1.HelmRelease) (string, error) {
+	if len(helmObj.Spec.ValuesFrom) == 0 && helmObj.Spec.ValuesObject == nil {
+		return helmObj.Spec.Values, nil
+	}
+
+	values := map[string]interface{}{}
+	for _, src := range helmObj.Spec.ValuesFrom {
+		data, found, err := c.valuesSourceData(helmObj.Namespace, src)
+		if err != nil {
+			return "", withReason(reasonValuesSourceError, err)
+		}
+		if !found {
+			continue
+		}
+		if src.TargetPath != "" {
+			setValue(values, src.TargetPath, string(data))
+			continue
+		}
+		vals, err := chartutil.ReadValues(data)
+		if err != nil {
+			return "", withReason(reasonValuesSourceError, fmt.Errorf("unable to parse values from %s: %v", valuesSourceName(src), err))
+		}
+		mergeValues(values, vals)
+	}
+
+	inline, err := chartutil.ReadValues([]byte(helmObj.Spec.Values))
+	if err != nil {
+		return "", withReason(reasonInvalidValues, fmt.Errorf("unable to parse values: %v", err))
+	}
+	mergeValues(values, inline)
+
+	if obj := helmObj.Spec.ValuesObject; obj != nil && len(obj.Raw) > 0 {
+		// JSON is valid YAML
+		structured, err := chartutil.ReadValues(obj.Raw)
+		if err != nil {
+			return "", withReason(reasonInvalidValues, fmt.Errorf("unable to parse valuesObject: %v", err))
+		}
+		mergeValues(values, structured)
+	}
+
+	out, err := yaml.Marshal(values)
+	if err != nil {
+		return "", withReason(reasonInvalidValues, err)
+	}
+	return string(out), nil
+}
+
+func valuesSourceName(src helmCrdV1.HelmReleaseValuesSource) string {
+	if src.ConfigMapKeyRef != nil {
+		return fmt.Sprintf("ConfigMap %s key %s", src.ConfigMapKeyRef.Name, src.ConfigMapKeyRef.Key)
+	}
+	if src.SecretKeyRef != nil {
+		return fmt.Sprintf("Secret %s key %s", src.SecretKeyRef.Name, src.SecretKeyRef.Key)
+	}
+	return "unknown source"
+}
+
+// mergeValues deep merges src into dst, src taking precedence
+func mergeValues(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcMap, srcIsMap := v.(map[string]interface{})
+		dstMap, dstIsMap := dst[k].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeValues(dstMap, srcMap)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// setValue sets value at the dot separated path, creating (or
+// replacing) intermediate tables as needed
+func setValue(values map[string]interface{}, path string, value interface{}) {
+	keys := strings.Split(path, ".")
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := values[k].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			values[k] = next
+		}
+		values = next
+	}
+	values[keys[len(keys)-1]] = value
+}
+
+// valuesSourceHandler enqueues the HelmReleases that take values from
+// a changed ConfigMap or Secret
+func (c *Controller) valuesSourceHandler(kind string) cache.ResourceEventHandlerFuncs {
+	enqueue := func(obj interface{}) {
+		key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+		if err != nil {
+			return
+		}
+		namespace, name, err := cache.SplitMetaNamespaceKey(key)
+		if err != nil {
+			return
+		}
+		objs, err := c.informer.GetIndexer().ByIndex(valuesFromIndex, valuesFromIndexKey(kind, namespace, name))
+		if err != nil {
+			return
+		}
+		for _, obj := range objs {
+			if releaseKey, err := cache.MetaNamespaceKeyFunc(obj); err == nil {
+				log.Printf("%s %s changed, updating %s", kind, key, releaseKey)
+				c.queue.Add(releaseKey)
+			}
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: enqueue,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if oldObj.(metav1.Object).GetResourceVersion() != newObj.(metav1.Object).GetResourceVersion() {
+				enqueue(newObj)
+			}
+		},
+		DeleteFunc: enqueue,
+	}
+}
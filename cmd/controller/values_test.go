@@ -0,0 +1,250 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/helm"
+
+	helmCrdV1 "github.com/bitnami-labs/helm-crd/pkg/apis/helm.bitnami.com/v1"
+)
+
+func TestMergeValues(t *testing.T) {
+	dst := map[string]interface{}{
+		"a": "1",
+		"b": map[string]interface{}{"c": "2", "d": "3"},
+		"e": map[string]interface{}{"f": "4"},
+	}
+	src := map[string]interface{}{
+		"b": map[string]interface{}{"c": "5"},
+		"e": "6",
+		"g": "7",
+	}
+	expected := map[string]interface{}{
+		"a": "1",
+		"b": map[string]interface{}{"c": "5", "d": "3"},
+		"e": "6",
+		"g": "7",
+	}
+	mergeValues(dst, src)
+	if !reflect.DeepEqual(dst, expected) {
+		t.Errorf("Expected %v received %v", expected, dst)
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	values := map[string]interface{}{
+		"a": map[string]interface{}{"b": "1"},
+		"c": "2",
+	}
+	setValue(values, "a.d", "3")
+	setValue(values, "c.e", "4")
+	setValue(values, "f", "5")
+	expected := map[string]interface{}{
+		"a": map[string]interface{}{"b": "1", "d": "3"},
+		"c": map[string]interface{}{"e": "4"},
+		"f": "5",
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v received %v", expected, values)
+	}
+}
+
+func TestReleaseValues(t *testing.T) {
+	optional := true
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "values"},
+		Data: map[string]string{
+			"values.yaml": "image:\n  tag: \"1.0\"\n  pullPolicy: Always\nreplicas: 1\n",
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "creds"},
+		Data: map[string][]byte{
+			"password": []byte("s3cr3t"),
+		},
+	}
+	cmRef := func(name, key string) *corev1.ConfigMapKeySelector {
+		return &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}
+	}
+	secretRef := func(name, key string) *corev1.SecretKeySelector {
+		return &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}
+	}
+
+	tests := []struct {
+		name     string
+		sources  []helmCrdV1.HelmReleaseValuesSource
+		values   string
+		object   string
+		expected map[string]interface{}
+		err      string
+	}{
+		{
+			name:    "configmap and inline values",
+			sources: []helmCrdV1.HelmReleaseValuesSource{{ConfigMapKeyRef: cmRef("values", "values.yaml")}},
+			values:  "image:\n  tag: \"2.0\"\n",
+			expected: map[string]interface{}{
+				"image":    map[string]interface{}{"tag": "2.0", "pullPolicy": "Always"},
+				"replicas": float64(1),
+			},
+		},
+		{
+			name: "secret at target path",
+			sources: []helmCrdV1.HelmReleaseValuesSource{
+				{ConfigMapKeyRef: cmRef("values", "values.yaml")},
+				{SecretKeyRef: secretRef("creds", "password"), TargetPath: "db.password"},
+			},
+			expected: map[string]interface{}{
+				"image":    map[string]interface{}{"tag": "1.0", "pullPolicy": "Always"},
+				"replicas": float64(1),
+				"db":       map[string]interface{}{"password": "s3cr3t"},
+			},
+		},
+		{
+			name:    "missing configmap",
+			sources: []helmCrdV1.HelmReleaseValuesSource{{ConfigMapKeyRef: cmRef("other", "values.yaml")}},
+			err:     reasonValuesSourceError,
+		},
+		{
+			name:    "missing key",
+			sources: []helmCrdV1.HelmReleaseValuesSource{{SecretKeyRef: secretRef("creds", "user"), TargetPath: "db.user"}},
+			err:     reasonValuesSourceError,
+		},
+		{
+			name:    "no reference",
+			sources: []helmCrdV1.HelmReleaseValuesSource{{TargetPath: "foo"}},
+			err:     reasonValuesSourceError,
+		},
+		{
+			name: "optional missing references",
+			sources: []helmCrdV1.HelmReleaseValuesSource{
+				{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "other"}, Key: "values.yaml", Optional: &optional}},
+				{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "creds"}, Key: "user", Optional: &optional}},
+			},
+			values:   "foo: bar",
+			expected: map[string]interface{}{"foo": "bar"},
+		},
+		{
+			name:   "values object over values",
+			values: "image:\n  tag: \"2.0\"\nfoo: bar\n",
+			object: `{"image": {"tag": "3.0"}, "replicas": 2}`,
+			expected: map[string]interface{}{
+				"image":    map[string]interface{}{"tag": "3.0"},
+				"foo":      "bar",
+				"replicas": float64(2),
+			},
+		},
+		{
+			name:    "values object over sources",
+			sources: []helmCrdV1.HelmReleaseValuesSource{{ConfigMapKeyRef: cmRef("values", "values.yaml")}},
+			object:  `{"replicas": 3}`,
+			expected: map[string]interface{}{
+				"image":    map[string]interface{}{"tag": "1.0", "pullPolicy": "Always"},
+				"replicas": float64(3),
+			},
+		},
+		{
+			name:   "values object not an object",
+			object: `["foo"]`,
+			err:    reasonInvalidValues,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := prepareTestController([]helmCrdV1.HelmRelease{}, []string{})
+			controller.configMapInformer.GetIndexer().Add(cm)
+			controller.secretInformer.GetIndexer().Add(secret)
+			h := &helmCrdV1.HelmRelease{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "foo"},
+				Spec:       helmCrdV1.HelmReleaseSpec{ValuesFrom: tt.sources, Values: tt.values},
+			}
+			if tt.object != "" {
+				h.Spec.ValuesObject = &runtime.RawExtension{Raw: []byte(tt.object)}
+			}
+			res, err := controller.releaseValues(h)
+			if tt.err != "" {
+				if err == nil {
+					t.Errorf("Expected error")
+				} else if reason := errorReason(err); reason != tt.err {
+					t.Errorf("Expected reason %s received %s", tt.err, reason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			values, err := chartutil.ReadValues([]byte(res))
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(map[string]interface{}(values), tt.expected) {
+				t.Errorf("Expected %v received %v", tt.expected, values)
+			}
+		})
+	}
+}
+
+func TestHelmReleaseValuesFrom(t *testing.T) {
+	h := helmCrdV1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "foo"},
+		Spec: helmCrdV1.HelmReleaseSpec{
+			RepoURL:   "http://charts.example.com/repo/",
+			ChartName: "foo",
+			Version:   "v1.0.0",
+			ValuesFrom: []helmCrdV1.HelmReleaseValuesSource{
+				{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "values"}, Key: "values.yaml"}},
+			},
+		},
+	}
+
+	t.Run("install with values", func(t *testing.T) {
+		controller := prepareTestController([]helmCrdV1.HelmRelease{h}, []string{})
+		controller.configMapInformer.GetIndexer().Add(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "values"},
+			Data:       map[string]string{"values.yaml": "foo: bar"},
+		})
+		if err := controller.updateRelease("myns/foo"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		opts := reflect.ValueOf(controller.helmClient.(*helm.FakeClient).Opts)
+		if raw := opts.FieldByName("instReq").FieldByName("Values").Elem().FieldByName("Raw").String(); raw != "foo: bar\n" {
+			t.Errorf("Expected values from ConfigMap received %q", raw)
+		}
+	})
+
+	t.Run("missing values", func(t *testing.T) {
+		controller := prepareTestController([]helmCrdV1.HelmRelease{h}, []string{})
+		if err := controller.updateRelease("myns/foo"); err == nil {
+			t.Fatalf("Expected error")
+		}
+		checkEvents(t, controller, []string{"Warning " + reasonValuesSourceError})
+		if len(controller.helmClient.(*helm.FakeClient).Rels) != 0 {
+			t.Errorf("Unexpected release installed")
+		}
+	})
+
+	t.Run("configmap changed", func(t *testing.T) {
+		controller := prepareTestController([]helmCrdV1.HelmRelease{h}, []string{})
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "values", ResourceVersion: "1"}}
+		updated := cm.DeepCopy()
+		updated.ResourceVersion = "2"
+		controller.valuesSourceHandler(configMapKind).OnUpdate(cm, updated)
+		if controller.queue.Len() != 1 {
+			t.Fatalf("Expected referencing release to be queued")
+		}
+		if key, _ := controller.queue.Get(); key != "myns/foo" {
+			t.Errorf("Expected myns/foo to be queued received %v", key)
+		}
+
+		other := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "myns", Name: "other"}}
+		controller.valuesSourceHandler(configMapKind).OnAdd(other)
+		controller.valuesSourceHandler(secretKind).OnAdd(cm)
+		if controller.queue.Len() != 0 {
+			t.Errorf("Unexpected release queued")
+		}
+	})
+}
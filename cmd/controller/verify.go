@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log"
+	"sort"
+
+	helmCrdV1 "github.com/bitnami-labs/helm-crd/pkg/apis/helm.bitnami.com/v1"
+	chartUtils "github.com/bitnami-labs/helm-crd/pkg/utils/chart"
+)
+
+// verifyProvenance checks the provenance file of the chart archive
+// downloaded from chartURL against the keyring in spec.verify
+func (c *Controller) verifyProvenance(helmObj *helmCrdV1.HelmRelease, getter chartUtils.Getter, chartURL, authHeader string, archive []byte) error {
+	v := helmObj.Spec.Verify
+	secret, err := c.getSecret(helmObj.Namespace, v.Namespace, v.KeyringSecretKeyRef.Name)
+	if err != nil {
+		return err
+	}
+	keyring, err := secretValue(secret, v.KeyringSecretKeyRef.Key)
+	if err != nil {
+		return err
+	}
+
+	prov, err := chartUtils.FetchProvenance(getter, chartURL, authHeader)
+	if err != nil {
+		return withReason(reasonVerificationFailed, err)
+	}
+	ver, err := chartUtils.VerifyProvenance(archive, prov, chartURL, keyring)
+	if err != nil {
+		return withReason(reasonVerificationFailed, err)
+	}
+
+	var signers []string
+	for name := range ver.SignedBy.Identities {
+		signers = append(signers, name)
+	}
+	sort.Strings(signers)
+	log.Printf("Chart %s (%s) signed by %v", chartURL, ver.FileHash, signers)
+	return nil
+}
@@ -0,0 +1,130 @@
+// RBAC objects for the controller, watching either the whole cluster
+// or only some namespaces (the controller --namespaces flag).
+//
+// Tiller, which the controller runs next to, needs its own
+// permissions to install charts; they aren't included here.
+
+{
+  // Rules in each namespace the controller watches
+  namespacedRules:: [
+    {
+      apiGroups: ["helm.bitnami.com"],
+      resources: ["helmreleases"],
+      verbs: ["get", "list", "watch", "update"],
+    },
+    {
+      apiGroups: ["helm.bitnami.com"],
+      resources: ["helmrepositories"],
+      verbs: ["get", "list", "watch"],
+    },
+    {
+      apiGroups: ["helm.bitnami.com"],
+      resources: ["helmreleases/status", "helmrepositories/status"],
+      verbs: ["update"],
+    },
+    // Repository credentials, and valuesFrom sources which are read
+    // from the caches watched to trigger upgrades
+    {
+      apiGroups: [""],
+      resources: ["configmaps", "secrets"],
+      verbs: ["get", "list", "watch"],
+    },
+    {
+      apiGroups: [""],
+      resources: ["events"],
+      verbs: ["create", "patch"],
+    },
+  ],
+
+  // Rules in the namespaces of Secrets and ConfigMaps allowed to be
+  // referenced across namespaces (the controller
+  // --auth-secret-allowlist flag) but not watched: credentials are
+  // read with gets, without the caches
+  authRules:: [
+    {
+      apiGroups: [""],
+      resources: ["configmaps", "secrets"],
+      verbs: ["get"],
+    },
+  ],
+
+  // Additional rules when watching all namespaces
+  clusterRules:: [
+    {
+      apiGroups: ["helm.bitnami.com"],
+      resources: ["clusterhelmrepositories"],
+      verbs: ["get", "list", "watch"],
+    },
+    {
+      apiGroups: ["helm.bitnami.com"],
+      resources: ["clusterhelmrepositories/status"],
+      verbs: ["update"],
+    },
+  ],
+
+  // Rules for the leader election lock (--leader-elect), in the
+  // controller's namespace
+  leaderElectionRules:: [
+    {
+      apiGroups: [""],
+      resources: ["configmaps"],
+      verbs: ["get", "create", "update"],
+    },
+    {
+      apiGroups: [""],
+      resources: ["events"],
+      verbs: ["create", "patch"],
+    },
+  ],
+
+  // Roles and bindings for the controller running as serviceAccount
+  // in namespace, watching watchNamespaces (all namespaces if empty).
+  // Watching some namespaces only requires namespaced Roles, plus
+  // authRules in the other authNamespaces, those of the
+  // --auth-secret-allowlist entries.
+  ControllerRBAC(name, serviceAccount, namespace, watchNamespaces=[], authNamespaces=[])::
+    local subjects = [
+      {kind: "ServiceAccount", name: serviceAccount, namespace: namespace},
+    ];
+
+    local role(kind, roleName, ns, rules) = {
+      apiVersion: "rbac.authorization.k8s.io/v1",
+      kind: kind,
+      metadata: {name: roleName} + (if ns != null then {namespace: ns} else {}),
+      rules: rules,
+    };
+
+    local binding(kind, roleKind, roleName, ns) = {
+      apiVersion: "rbac.authorization.k8s.io/v1",
+      kind: kind,
+      metadata: {name: roleName} + (if ns != null then {namespace: ns} else {}),
+      roleRef: {
+        apiGroup: "rbac.authorization.k8s.io",
+        kind: roleKind,
+        name: roleName,
+      },
+      subjects: subjects,
+    };
+
+    {
+      leaderElectionRole: role("Role", name + "-leader-election", namespace, $.leaderElectionRules),
+      leaderElectionBinding: binding("RoleBinding", "Role", name + "-leader-election", namespace),
+    } + (
+      if std.length(watchNamespaces) == 0 then {
+        clusterRole: role("ClusterRole", name, null, $.namespacedRules + $.clusterRules),
+        clusterBinding: binding("ClusterRoleBinding", "ClusterRole", name, null),
+      } else {
+        ["role-" + ns]: role("Role", name, ns, $.namespacedRules)
+        for ns in watchNamespaces
+      } + {
+        ["binding-" + ns]: binding("RoleBinding", "Role", name, ns)
+        for ns in watchNamespaces
+      } + {
+        ["auth-role-" + ns]: role("Role", name + "-auth", ns, $.authRules)
+        for ns in std.setDiff(std.set(authNamespaces), std.set(watchNamespaces))
+      } + {
+        ["auth-binding-" + ns]: binding("RoleBinding", "Role", name + "-auth", ns)
+        for ns in std.setDiff(std.set(authNamespaces), std.set(watchNamespaces))
+      }
+    ),
+}
@@ -10,7 +10,7 @@ local remapChar(c, start, end, newstart) =
     std.join("", [remapChar(c, "A", "Z", "a") for c in std.stringChars(s)])
   ),
 
-  CustomResourceDefinition(group, version, kind):: {
+  CustomResourceDefinition(group, version, kind, plural=null, scope="Namespaced"):: {
     local this = self,
     apiVersion: "apiextensions.k8s.io/v1beta1",
     kind: "CustomResourceDefinition",
@@ -18,15 +18,18 @@ local remapChar(c, start, end, newstart) =
       name: this.spec.names.plural + "." + this.spec.group,
     },
     spec: {
-      scope: "Namespaced",
+      scope: scope,
       group: group,
       version: version,
       names: {
         kind: kind,
         singular: $.toLower(self.kind),
-        plural: self.singular + "s",
+        plural: if plural != null then plural else self.singular + "s",
         listKind: self.kind + "List",
       },
+      subresources: {
+        status: {},
+      },
     },
   },
 }
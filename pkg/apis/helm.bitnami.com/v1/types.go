@@ -3,44 +3,267 @@ package v1
 import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 // +genclient
-// +genclient:noStatus
 
 // HelmRelease describes a Helm chart release.
 type HelmRelease struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec HelmReleaseSpec `json:"spec"`
+	Spec   HelmReleaseSpec   `json:"spec"`
+	Status HelmReleaseStatus `json:"status,omitempty"`
 }
 
 // HelmReleaseSpec is the spec for a HelmRelease resource.
 type HelmReleaseSpec struct {
 	// RepoURL is the URL of the repository. Defaults to stable repo.
 	RepoURL string `json:"repoUrl,omitempty"`
+	// Mirrors are URLs of mirrors of RepoURL, tried in order when its index can't be fetched. They use the same Auth.
+	Mirrors []string `json:"mirrors,omitempty"`
+	// Repository is a HelmRepository or ClusterHelmRepository to use instead of RepoURL and Auth
+	Repository *HelmReleaseRepositoryRef `json:"repository,omitempty"`
 	// ChartName is the name of the chart within the repo
 	ChartName string `json:"chartName,omitempty"`
 	// ReleaseName is the Name of the release given to Tiller. Defaults to namespace-name. Must not be changed after initial object creation.
 	ReleaseName string `json:"releaseName,omitempty"`
-	// Version is the chart version
+	// Version is the chart version, or a semver range (eg: "~2.0" or ">=1.2 <2"). Releases of a range
+	// are upgraded when a newer matching version is published. An empty version installs the newest
+	// version without following newer ones, unlike "*".
 	Version string `json:"version,omitempty"`
+	// Prereleases allows Version ranges to match pre-release versions (eg: 2.1.0-rc.1)
+	Prereleases bool `json:"prereleases,omitempty"`
+	// ChartRef is a reference to a chart in an OCI registry (eg: oci://registry.example.com/charts/mariadb:1.0.0),
+	// used instead of RepoURL and ChartName. Version is used if the reference has no tag.
+	ChartRef string `json:"chartRef,omitempty"`
+	// ChartURL is the URL of a chart archive (http, https or file), used instead of RepoURL,
+	// Repository, ChartName and ChartRef. Auth and Verify apply to it.
+	ChartURL string `json:"chartUrl,omitempty"`
+	// Source is a chart source other than chart repositories and registries, used instead of
+	// RepoURL, Repository, ChartName and ChartRef
+	Source *HelmReleaseSource `json:"source,omitempty"`
 	// Auth is the authentication
 	Auth HelmReleaseAuth `json:"auth,omitempty"`
+	// Verify enables the verification of the chart's provenance file before install
+	Verify *HelmReleaseVerify `json:"verify,omitempty"`
+	// ValuesFrom lists ConfigMap and Secret keys holding values, merged in order before Values
+	ValuesFrom []HelmReleaseValuesSource `json:"valuesFrom,omitempty"`
 	// Values is a string containing (unparsed) YAML values
 	Values string `json:"values,omitempty"`
+	// ValuesObject holds values as a structured object. Keys set here take precedence over Values.
+	ValuesObject *runtime.RawExtension `json:"valuesObject,omitempty"`
+	// Timeout is the time in seconds Tiller waits for any individual Kubernetes operation (like Jobs for hooks). Defaults to 300.
+	Timeout int64 `json:"timeout,omitempty"`
+	// Wait waits until all resources are ready before marking an install or upgrade successful
+	Wait bool `json:"wait,omitempty"`
+	// DisableHooks prevents hooks from running on install, upgrade, rollback and delete
+	DisableHooks bool `json:"disableHooks,omitempty"`
+	// Rollback pins the release to a previous Tiller revision. Chart and values are ignored while set.
+	Rollback *HelmReleaseRollback `json:"rollback,omitempty"`
+	// Upgrade configures how the release is upgraded
+	Upgrade HelmReleaseUpgrade `json:"upgrade,omitempty"`
+	// Delete configures how the release is deleted
+	Delete HelmReleaseDelete `json:"delete,omitempty"`
+}
+
+type HelmReleaseRepositoryRef struct {
+	// Name of the repository
+	Name string `json:"name"`
+	// Kind of the repository, HelmRepository (in the HelmRelease's namespace, the default)
+	// or ClusterHelmRepository
+	Kind string `json:"kind,omitempty"`
+}
+
+type HelmReleaseSource struct {
+	// Git is a chart in a git repository
+	Git *HelmReleaseGitSource `json:"git,omitempty"`
+}
+
+type HelmReleaseGitSource struct {
+	// URL of the repository (eg: https://github.com/example/charts.git or ssh://git@github.com/example/charts.git).
+	// Local paths and file URLs are not supported.
+	URL string `json:"url"`
+	// Ref is the branch, tag or commit to check out. Defaults to the remote HEAD.
+	// Releases of branches are upgraded when new commits are pushed.
+	Ref string `json:"ref,omitempty"`
+	// Path is the directory of the chart in the repository. Defaults to the root.
+	Path string `json:"path,omitempty"`
+	// Auth is the authentication for http(s) URLs
+	Auth HelmReleaseAuth `json:"auth,omitempty"`
+	// SSHKey is the authentication for ssh URLs
+	SSHKey *HelmReleaseGitSSHKey `json:"sshKey,omitempty"`
+}
+
+type HelmReleaseGitSSHKey struct {
+	// SecretRef is a secret with "ssh-privatekey" (eg: of type kubernetes.io/ssh-auth) and
+	// "known_hosts" keys
+	SecretRef corev1.LocalObjectReference `json:"secretRef"`
+	// Namespace of the secret. Defaults to the HelmRelease's namespace.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+type HelmReleaseValuesSource struct {
+	// ConfigMapKeyRef selects a key of a ConfigMap in the HelmRelease's namespace
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+	// SecretKeyRef selects a key of a Secret in the HelmRelease's namespace
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+	// TargetPath is the dot separated path (eg: "db.password") the value is set at, as a string.
+	// If empty, the value is parsed as YAML and merged at the top level.
+	TargetPath string `json:"targetPath,omitempty"`
+}
+
+type HelmReleaseRollback struct {
+	// Revision is the Tiller release revision to roll back to
+	Revision int32 `json:"revision"`
+	// Force forces resource updates through delete/recreate if needed
+	Force bool `json:"force,omitempty"`
+	// Recreate restarts pods for the resources if applicable
+	Recreate bool `json:"recreate,omitempty"`
+	// Wait waits until all resources are ready before marking the rollback successful
+	Wait bool `json:"wait,omitempty"`
+}
+
+type HelmReleaseUpgrade struct {
+	// Force forces resource updates through delete/recreate if needed
+	Force bool `json:"force,omitempty"`
+	// RecreatePods restarts pods for the resources if applicable
+	RecreatePods bool `json:"recreatePods,omitempty"`
+	// ReuseValues reuses the values of the last release and merges in Values. Ignored if ResetValues is set.
+	ReuseValues bool `json:"reuseValues,omitempty"`
+	// ResetValues resets the values to the ones built into the chart
+	ResetValues bool `json:"resetValues,omitempty"`
+	// RollbackOnFailure rolls back to the last good revision when an upgrade fails
+	RollbackOnFailure bool `json:"rollbackOnFailure,omitempty"`
+}
+
+type HelmReleaseDelete struct {
+	// Purge removes the release from Tiller history, freeing its name. Defaults to true.
+	Purge *bool `json:"purge,omitempty"`
 }
 
 type HelmReleaseAuth struct {
 	// Header is header based Authorization
 	Header *HelmReleaseAuthHeader `json:"header,omitempty"`
+	// Basic is username and password authentication. Only one of Header, Basic and BearerToken can be set.
+	Basic *HelmReleaseAuthBasic `json:"basic,omitempty"`
+	// BearerToken is bearer token authentication
+	BearerToken *HelmReleaseAuthBearerToken `json:"bearerToken,omitempty"`
+	// TLS configures client certificates and CAs
+	TLS *HelmReleaseAuthTLS `json:"tls,omitempty"`
+}
+
+type HelmReleaseVerify struct {
+	// KeyringSecretKeyRef selects a key of a secret holding the public keyring (binary or
+	// ASCII armored) the chart must be signed with
+	KeyringSecretKeyRef corev1.SecretKeySelector `json:"keyringSecretKeyRef"`
+	// Namespace of the secret. Defaults to the HelmRelease's namespace, other
+	// namespaces must be allowed with the controller --auth-secret-allowlist flag.
+	Namespace string `json:"namespace,omitempty"`
 }
 
 type HelmReleaseAuthHeader struct {
-	// Selects a key of a secret in the pod's namespace
+	// Selects a key of a secret
 	SecretKeyRef corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+	// Namespace of the secret. Defaults to the HelmRelease's namespace, other
+	// namespaces must be allowed with the controller --auth-secret-allowlist flag.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+type HelmReleaseAuthBasic struct {
+	// SecretRef is a secret with "username" and "password" keys (eg: of type kubernetes.io/basic-auth)
+	SecretRef corev1.LocalObjectReference `json:"secretRef"`
+	// Namespace of the secret. Defaults to the HelmRelease's namespace.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+type HelmReleaseAuthBearerToken struct {
+	// Selects the key of a secret holding the token
+	SecretKeyRef corev1.SecretKeySelector `json:"secretKeyRef"`
+	// Namespace of the secret. Defaults to the HelmRelease's namespace.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+type HelmReleaseAuthTLS struct {
+	// ClientCertSecretRef is a secret with "tls.crt" and "tls.key" keys (eg: of type kubernetes.io/tls)
+	// used for mutual TLS
+	ClientCertSecretRef *corev1.LocalObjectReference `json:"clientCertSecretRef,omitempty"`
+	// CASecretKeyRef selects the key of a secret holding PEM encoded CA certificates
+	CASecretKeyRef *corev1.SecretKeySelector `json:"caSecretKeyRef,omitempty"`
+	// CAConfigMapKeyRef selects the key of a ConfigMap holding PEM encoded CA certificates
+	CAConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"caConfigMapKeyRef,omitempty"`
+	// Namespace of the secrets and ConfigMap. Defaults to the HelmRelease's namespace.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// HelmReleaseStatus is the most recently observed status of a HelmRelease.
+type HelmReleaseStatus struct {
+	// ObservedGeneration is the most recent generation observed by the controller
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// ReleaseStatus is the Tiller status code of the release (eg: DEPLOYED, FAILED)
+	ReleaseStatus string `json:"releaseStatus,omitempty"`
+	// Revision is the deployed Tiller release revision
+	Revision int32 `json:"revision,omitempty"`
+	// ChartVersion is the resolved version of the deployed chart
+	ChartVersion string `json:"chartVersion,omitempty"`
+	// GitCommit is the commit the deployed chart was checked out from, for git sources
+	GitCommit string `json:"gitCommit,omitempty"`
+	// Source is where the deployed chart was fetched from: the URL of its archive, its OCI reference,
+	// or its git repository and commit
+	Source string `json:"source,omitempty"`
+	// RollbackRevision is the revision the release was last rolled back to by the controller
+	RollbackRevision int32 `json:"rollbackRevision,omitempty"`
+	// FailedUpgrade is the last upgrade rolled back by the controller after it failed (see
+	// upgrade.rollbackOnFailure). It isn't retried until the spec changes or a backoff expires.
+	FailedUpgrade *HelmReleaseFailedUpgrade `json:"failedUpgrade,omitempty"`
+	// Drift describes how the deployed release differed from the spec when last checked, if it did
+	Drift string `json:"drift,omitempty"`
+	// LastError is the error message of the last failed reconcile, if any
+	LastError string `json:"lastError,omitempty"`
+	// Conditions are the latest available observations of the release state
+	Conditions []HelmReleaseCondition `json:"conditions,omitempty"`
+}
+
+// HelmReleaseFailedUpgrade describes an upgrade that failed and was rolled back.
+type HelmReleaseFailedUpgrade struct {
+	// Generation is the generation of the HelmRelease the upgrade was for
+	Generation int64 `json:"generation"`
+	// ChartVersion is the version of the chart the release failed to be upgraded to
+	ChartVersion string `json:"chartVersion,omitempty"`
+	// GitCommit is the commit that chart was checked out from, for git sources
+	GitCommit string `json:"gitCommit,omitempty"`
+	// Error is the error the upgrade failed with
+	Error string `json:"error,omitempty"`
+	// Time is when the upgrade failed
+	Time metav1.Time `json:"time"`
+}
+
+// HelmReleaseConditionType is a valid value for HelmReleaseCondition.Type
+type HelmReleaseConditionType string
+
+const (
+	// HelmReleaseReady means the release has been installed or upgraded and is deployed
+	HelmReleaseReady HelmReleaseConditionType = "Ready"
+	// HelmReleaseReconciling means the controller is working towards the desired state
+	HelmReleaseReconciling HelmReleaseConditionType = "Reconciling"
+	// HelmReleaseFailed means the last reconcile failed
+	HelmReleaseFailed HelmReleaseConditionType = "Failed"
+)
+
+// HelmReleaseCondition describes the state of a HelmRelease at a certain point.
+type HelmReleaseCondition struct {
+	// Type of the condition
+	Type HelmReleaseConditionType `json:"type"`
+	// Status of the condition, one of True, False, Unknown
+	Status corev1.ConditionStatus `json:"status"`
+	// LastTransitionTime is the last time the condition changed status
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// Reason is a machine readable code for the last transition
+	Reason string `json:"reason,omitempty"`
+	// Message is a human readable description of the last transition
+	Message string `json:"message,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -52,3 +275,98 @@ type HelmReleaseList struct {
 
 	Items []HelmRelease `json:"items"`
 }
+
+// +genclient
+
+// HelmRepository is a chart repository shared by the HelmReleases of
+// a namespace.
+type HelmRepository struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   HelmRepositorySpec   `json:"spec"`
+	Status HelmRepositoryStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// HelmRepositoryList is a list of HelmRepository resources
+type HelmRepositoryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []HelmRepository `json:"items"`
+}
+
+// +genclient
+// +genclient:nonNamespaced
+
+// ClusterHelmRepository is a chart repository shared by all the
+// HelmReleases of the cluster.
+type ClusterHelmRepository struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   HelmRepositorySpec   `json:"spec"`
+	Status HelmRepositoryStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClusterHelmRepositoryList is a list of ClusterHelmRepository resources
+type ClusterHelmRepositoryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []ClusterHelmRepository `json:"items"`
+}
+
+// HelmRepositorySpec is the spec for HelmRepository and ClusterHelmRepository resources.
+type HelmRepositorySpec struct {
+	// URL is the URL of the repository
+	URL string `json:"url"`
+	// Mirrors are URLs of mirrors of the repository, tried in order when the index can't be fetched from URL
+	Mirrors []string `json:"mirrors,omitempty"`
+	// Auth is the authentication. Secrets of a ClusterHelmRepository must have a namespace.
+	Auth HelmReleaseAuth `json:"auth,omitempty"`
+	// RefreshInterval is the interval between fetches of the repository index. Defaults to 10m.
+	RefreshInterval *metav1.Duration `json:"refreshInterval,omitempty"`
+}
+
+// HelmRepositoryConditionType is a valid value for HelmRepositoryCondition.Type
+type HelmRepositoryConditionType string
+
+const (
+	// HelmRepositoryReady means the repository index was fetched successfully
+	HelmRepositoryReady HelmRepositoryConditionType = "Ready"
+)
+
+// HelmRepositoryCondition describes the state of a repository at a certain point.
+type HelmRepositoryCondition struct {
+	// Type of the condition
+	Type HelmRepositoryConditionType `json:"type"`
+	// Status of the condition, one of True, False, Unknown
+	Status corev1.ConditionStatus `json:"status"`
+	// LastTransitionTime is the last time the condition changed status
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// Reason is a machine readable code for the last transition
+	Reason string `json:"reason,omitempty"`
+	// Message is a human readable description of the last transition
+	Message string `json:"message,omitempty"`
+}
+
+// HelmRepositoryStatus is the most recently observed status of a repository.
+type HelmRepositoryStatus struct {
+	// ObservedGeneration is the most recent generation observed by the controller
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastFetchTime is the last time the index was fetched successfully
+	LastFetchTime *metav1.Time `json:"lastFetchTime,omitempty"`
+	// URL is the repository URL or mirror the index was last fetched from
+	URL string `json:"url,omitempty"`
+	// Charts is the number of charts in the index
+	Charts int32 `json:"charts,omitempty"`
+	// LastError is the error of the last fetch, if it failed
+	LastError string `json:"lastError,omitempty"`
+	// Conditions are the latest observations of the repository's state
+	Conditions []HelmRepositoryCondition `json:"conditions,omitempty"`
+}
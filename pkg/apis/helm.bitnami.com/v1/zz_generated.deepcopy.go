@@ -21,6 +21,8 @@ limitations under the License.
 package v1
 
 import (
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	conversion "k8s.io/apimachinery/pkg/conversion"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 	reflect "reflect"
@@ -36,6 +38,14 @@ func init() {
 // Deprecated: deepcopy registration will go away when static deepcopy is fully implemented.
 func RegisterDeepCopies(scheme *runtime.Scheme) error {
 	return scheme.AddGeneratedDeepCopyFuncs(
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*ClusterHelmRepository).DeepCopyInto(out.(*ClusterHelmRepository))
+			return nil
+		}, InType: reflect.TypeOf(&ClusterHelmRepository{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*ClusterHelmRepositoryList).DeepCopyInto(out.(*ClusterHelmRepositoryList))
+			return nil
+		}, InType: reflect.TypeOf(&ClusterHelmRepositoryList{})},
 		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
 			in.(*HelmRelease).DeepCopyInto(out.(*HelmRelease))
 			return nil
@@ -44,27 +54,167 @@ func RegisterDeepCopies(scheme *runtime.Scheme) error {
 			in.(*HelmReleaseAuth).DeepCopyInto(out.(*HelmReleaseAuth))
 			return nil
 		}, InType: reflect.TypeOf(&HelmReleaseAuth{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*HelmReleaseAuthBasic).DeepCopyInto(out.(*HelmReleaseAuthBasic))
+			return nil
+		}, InType: reflect.TypeOf(&HelmReleaseAuthBasic{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*HelmReleaseAuthBearerToken).DeepCopyInto(out.(*HelmReleaseAuthBearerToken))
+			return nil
+		}, InType: reflect.TypeOf(&HelmReleaseAuthBearerToken{})},
 		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
 			in.(*HelmReleaseAuthHeader).DeepCopyInto(out.(*HelmReleaseAuthHeader))
 			return nil
 		}, InType: reflect.TypeOf(&HelmReleaseAuthHeader{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*HelmReleaseAuthTLS).DeepCopyInto(out.(*HelmReleaseAuthTLS))
+			return nil
+		}, InType: reflect.TypeOf(&HelmReleaseAuthTLS{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*HelmReleaseCondition).DeepCopyInto(out.(*HelmReleaseCondition))
+			return nil
+		}, InType: reflect.TypeOf(&HelmReleaseCondition{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*HelmReleaseDelete).DeepCopyInto(out.(*HelmReleaseDelete))
+			return nil
+		}, InType: reflect.TypeOf(&HelmReleaseDelete{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*HelmReleaseGitSSHKey).DeepCopyInto(out.(*HelmReleaseGitSSHKey))
+			return nil
+		}, InType: reflect.TypeOf(&HelmReleaseGitSSHKey{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*HelmReleaseGitSource).DeepCopyInto(out.(*HelmReleaseGitSource))
+			return nil
+		}, InType: reflect.TypeOf(&HelmReleaseGitSource{})},
 		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
 			in.(*HelmReleaseList).DeepCopyInto(out.(*HelmReleaseList))
 			return nil
 		}, InType: reflect.TypeOf(&HelmReleaseList{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*HelmReleaseRepositoryRef).DeepCopyInto(out.(*HelmReleaseRepositoryRef))
+			return nil
+		}, InType: reflect.TypeOf(&HelmReleaseRepositoryRef{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*HelmReleaseRollback).DeepCopyInto(out.(*HelmReleaseRollback))
+			return nil
+		}, InType: reflect.TypeOf(&HelmReleaseRollback{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*HelmReleaseSource).DeepCopyInto(out.(*HelmReleaseSource))
+			return nil
+		}, InType: reflect.TypeOf(&HelmReleaseSource{})},
 		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
 			in.(*HelmReleaseSpec).DeepCopyInto(out.(*HelmReleaseSpec))
 			return nil
 		}, InType: reflect.TypeOf(&HelmReleaseSpec{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*HelmReleaseStatus).DeepCopyInto(out.(*HelmReleaseStatus))
+			return nil
+		}, InType: reflect.TypeOf(&HelmReleaseStatus{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*HelmReleaseUpgrade).DeepCopyInto(out.(*HelmReleaseUpgrade))
+			return nil
+		}, InType: reflect.TypeOf(&HelmReleaseUpgrade{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*HelmReleaseValuesSource).DeepCopyInto(out.(*HelmReleaseValuesSource))
+			return nil
+		}, InType: reflect.TypeOf(&HelmReleaseValuesSource{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*HelmReleaseVerify).DeepCopyInto(out.(*HelmReleaseVerify))
+			return nil
+		}, InType: reflect.TypeOf(&HelmReleaseVerify{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*HelmRepository).DeepCopyInto(out.(*HelmRepository))
+			return nil
+		}, InType: reflect.TypeOf(&HelmRepository{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*HelmRepositoryCondition).DeepCopyInto(out.(*HelmRepositoryCondition))
+			return nil
+		}, InType: reflect.TypeOf(&HelmRepositoryCondition{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*HelmRepositoryList).DeepCopyInto(out.(*HelmRepositoryList))
+			return nil
+		}, InType: reflect.TypeOf(&HelmRepositoryList{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*HelmRepositorySpec).DeepCopyInto(out.(*HelmRepositorySpec))
+			return nil
+		}, InType: reflect.TypeOf(&HelmRepositorySpec{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*HelmRepositoryStatus).DeepCopyInto(out.(*HelmRepositoryStatus))
+			return nil
+		}, InType: reflect.TypeOf(&HelmRepositoryStatus{})},
 	)
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterHelmRepository) DeepCopyInto(out *ClusterHelmRepository) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterHelmRepository.
+func (in *ClusterHelmRepository) DeepCopy() *ClusterHelmRepository {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterHelmRepository)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterHelmRepository) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	} else {
+		return nil
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterHelmRepositoryList) DeepCopyInto(out *ClusterHelmRepositoryList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterHelmRepository, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterHelmRepositoryList.
+func (in *ClusterHelmRepositoryList) DeepCopy() *ClusterHelmRepositoryList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterHelmRepositoryList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterHelmRepositoryList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	} else {
+		return nil
+	}
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HelmRelease) DeepCopyInto(out *HelmRelease) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -99,6 +249,33 @@ func (in *HelmReleaseAuth) DeepCopyInto(out *HelmReleaseAuth) {
 			(*in).DeepCopyInto(*out)
 		}
 	}
+	if in.Basic != nil {
+		in, out := &in.Basic, &out.Basic
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(HelmReleaseAuthBasic)
+			**out = **in
+		}
+	}
+	if in.BearerToken != nil {
+		in, out := &in.BearerToken, &out.BearerToken
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(HelmReleaseAuthBearerToken)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(HelmReleaseAuthTLS)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	return
 }
 
@@ -112,6 +289,40 @@ func (in *HelmReleaseAuth) DeepCopy() *HelmReleaseAuth {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmReleaseAuthBasic) DeepCopyInto(out *HelmReleaseAuthBasic) {
+	*out = *in
+	out.SecretRef = in.SecretRef
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmReleaseAuthBasic.
+func (in *HelmReleaseAuthBasic) DeepCopy() *HelmReleaseAuthBasic {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmReleaseAuthBasic)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmReleaseAuthBearerToken) DeepCopyInto(out *HelmReleaseAuthBearerToken) {
+	*out = *in
+	in.SecretKeyRef.DeepCopyInto(&out.SecretKeyRef)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmReleaseAuthBearerToken.
+func (in *HelmReleaseAuthBearerToken) DeepCopy() *HelmReleaseAuthBearerToken {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmReleaseAuthBearerToken)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HelmReleaseAuthHeader) DeepCopyInto(out *HelmReleaseAuthHeader) {
 	*out = *in
@@ -129,6 +340,151 @@ func (in *HelmReleaseAuthHeader) DeepCopy() *HelmReleaseAuthHeader {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmReleaseAuthTLS) DeepCopyInto(out *HelmReleaseAuthTLS) {
+	*out = *in
+	if in.ClientCertSecretRef != nil {
+		in, out := &in.ClientCertSecretRef, &out.ClientCertSecretRef
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(core_v1.LocalObjectReference)
+			**out = **in
+		}
+	}
+	if in.CASecretKeyRef != nil {
+		in, out := &in.CASecretKeyRef, &out.CASecretKeyRef
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(core_v1.SecretKeySelector)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.CAConfigMapKeyRef != nil {
+		in, out := &in.CAConfigMapKeyRef, &out.CAConfigMapKeyRef
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(core_v1.ConfigMapKeySelector)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmReleaseAuthTLS.
+func (in *HelmReleaseAuthTLS) DeepCopy() *HelmReleaseAuthTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmReleaseAuthTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmReleaseCondition) DeepCopyInto(out *HelmReleaseCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmReleaseCondition.
+func (in *HelmReleaseCondition) DeepCopy() *HelmReleaseCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmReleaseCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmReleaseDelete) DeepCopyInto(out *HelmReleaseDelete) {
+	*out = *in
+	if in.Purge != nil {
+		in, out := &in.Purge, &out.Purge
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(bool)
+			**out = **in
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmReleaseDelete.
+func (in *HelmReleaseDelete) DeepCopy() *HelmReleaseDelete {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmReleaseDelete)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmReleaseFailedUpgrade) DeepCopyInto(out *HelmReleaseFailedUpgrade) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmReleaseFailedUpgrade.
+func (in *HelmReleaseFailedUpgrade) DeepCopy() *HelmReleaseFailedUpgrade {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmReleaseFailedUpgrade)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmReleaseGitSSHKey) DeepCopyInto(out *HelmReleaseGitSSHKey) {
+	*out = *in
+	out.SecretRef = in.SecretRef
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmReleaseGitSSHKey.
+func (in *HelmReleaseGitSSHKey) DeepCopy() *HelmReleaseGitSSHKey {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmReleaseGitSSHKey)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmReleaseGitSource) DeepCopyInto(out *HelmReleaseGitSource) {
+	*out = *in
+	in.Auth.DeepCopyInto(&out.Auth)
+	if in.SSHKey != nil {
+		in, out := &in.SSHKey, &out.SSHKey
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(HelmReleaseGitSSHKey)
+			**out = **in
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmReleaseGitSource.
+func (in *HelmReleaseGitSource) DeepCopy() *HelmReleaseGitSource {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmReleaseGitSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HelmReleaseList) DeepCopyInto(out *HelmReleaseList) {
 	*out = *in
@@ -163,10 +519,126 @@ func (in *HelmReleaseList) DeepCopyObject() runtime.Object {
 	}
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmReleaseRepositoryRef) DeepCopyInto(out *HelmReleaseRepositoryRef) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmReleaseRepositoryRef.
+func (in *HelmReleaseRepositoryRef) DeepCopy() *HelmReleaseRepositoryRef {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmReleaseRepositoryRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmReleaseRollback) DeepCopyInto(out *HelmReleaseRollback) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmReleaseRollback.
+func (in *HelmReleaseRollback) DeepCopy() *HelmReleaseRollback {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmReleaseRollback)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmReleaseSource) DeepCopyInto(out *HelmReleaseSource) {
+	*out = *in
+	if in.Git != nil {
+		in, out := &in.Git, &out.Git
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(HelmReleaseGitSource)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmReleaseSource.
+func (in *HelmReleaseSource) DeepCopy() *HelmReleaseSource {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmReleaseSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HelmReleaseSpec) DeepCopyInto(out *HelmReleaseSpec) {
 	*out = *in
+	if in.Mirrors != nil {
+		in, out := &in.Mirrors, &out.Mirrors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Repository != nil {
+		in, out := &in.Repository, &out.Repository
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(HelmReleaseRepositoryRef)
+			**out = **in
+		}
+	}
+	if in.Source != nil {
+		in, out := &in.Source, &out.Source
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(HelmReleaseSource)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	in.Auth.DeepCopyInto(&out.Auth)
+	if in.Verify != nil {
+		in, out := &in.Verify, &out.Verify
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(HelmReleaseVerify)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.ValuesFrom != nil {
+		in, out := &in.ValuesFrom, &out.ValuesFrom
+		*out = make([]HelmReleaseValuesSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ValuesObject != nil {
+		in, out := &in.ValuesObject, &out.ValuesObject
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(runtime.RawExtension)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.Rollback != nil {
+		in, out := &in.Rollback, &out.Rollback
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(HelmReleaseRollback)
+			**out = **in
+		}
+	}
+	out.Upgrade = in.Upgrade
+	in.Delete.DeepCopyInto(&out.Delete)
 	return
 }
 
@@ -179,3 +651,245 @@ func (in *HelmReleaseSpec) DeepCopy() *HelmReleaseSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmReleaseStatus) DeepCopyInto(out *HelmReleaseStatus) {
+	*out = *in
+	if in.FailedUpgrade != nil {
+		in, out := &in.FailedUpgrade, &out.FailedUpgrade
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(HelmReleaseFailedUpgrade)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]HelmReleaseCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmReleaseStatus.
+func (in *HelmReleaseStatus) DeepCopy() *HelmReleaseStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmReleaseStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmReleaseUpgrade) DeepCopyInto(out *HelmReleaseUpgrade) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmReleaseUpgrade.
+func (in *HelmReleaseUpgrade) DeepCopy() *HelmReleaseUpgrade {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmReleaseUpgrade)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmReleaseValuesSource) DeepCopyInto(out *HelmReleaseValuesSource) {
+	*out = *in
+	if in.ConfigMapKeyRef != nil {
+		in, out := &in.ConfigMapKeyRef, &out.ConfigMapKeyRef
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(core_v1.ConfigMapKeySelector)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(core_v1.SecretKeySelector)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmReleaseValuesSource.
+func (in *HelmReleaseValuesSource) DeepCopy() *HelmReleaseValuesSource {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmReleaseValuesSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmReleaseVerify) DeepCopyInto(out *HelmReleaseVerify) {
+	*out = *in
+	in.KeyringSecretKeyRef.DeepCopyInto(&out.KeyringSecretKeyRef)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmReleaseVerify.
+func (in *HelmReleaseVerify) DeepCopy() *HelmReleaseVerify {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmReleaseVerify)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmRepository) DeepCopyInto(out *HelmRepository) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmRepository.
+func (in *HelmRepository) DeepCopy() *HelmRepository {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmRepository)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *HelmRepository) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	} else {
+		return nil
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmRepositoryCondition) DeepCopyInto(out *HelmRepositoryCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmRepositoryCondition.
+func (in *HelmRepositoryCondition) DeepCopy() *HelmRepositoryCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmRepositoryCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmRepositoryList) DeepCopyInto(out *HelmRepositoryList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]HelmRepository, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmRepositoryList.
+func (in *HelmRepositoryList) DeepCopy() *HelmRepositoryList {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmRepositoryList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *HelmRepositoryList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	} else {
+		return nil
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmRepositorySpec) DeepCopyInto(out *HelmRepositorySpec) {
+	*out = *in
+	if in.Mirrors != nil {
+		in, out := &in.Mirrors, &out.Mirrors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.Auth.DeepCopyInto(&out.Auth)
+	if in.RefreshInterval != nil {
+		in, out := &in.RefreshInterval, &out.RefreshInterval
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(meta_v1.Duration)
+			**out = **in
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmRepositorySpec.
+func (in *HelmRepositorySpec) DeepCopy() *HelmRepositorySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmRepositorySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmRepositoryStatus) DeepCopyInto(out *HelmRepositoryStatus) {
+	*out = *in
+	if in.LastFetchTime != nil {
+		in, out := &in.LastFetchTime, &out.LastFetchTime
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(meta_v1.Time)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]HelmRepositoryCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmRepositoryStatus.
+func (in *HelmRepositoryStatus) DeepCopy() *HelmRepositoryStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmRepositoryStatus)
+	in.DeepCopyInto(out)
+	return out
+}
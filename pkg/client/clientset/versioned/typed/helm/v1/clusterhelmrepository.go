@@ -0,0 +1,160 @@
+/*
+Copyright 2018 The helm-crd-controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1
+
+import (
+	v1 "github.com/bitnami-labs/helm-crd/pkg/apis/helm.bitnami.com/v1"
+	scheme "github.com/bitnami-labs/helm-crd/pkg/client/clientset/versioned/scheme"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// ClusterHelmRepositoriesGetter has a method to return a ClusterHelmRepositoryInterface.
+// A group's client should implement this interface.
+type ClusterHelmRepositoriesGetter interface {
+	ClusterHelmRepositories() ClusterHelmRepositoryInterface
+}
+
+// ClusterHelmRepositoryInterface has methods to work with ClusterHelmRepository resources.
+type ClusterHelmRepositoryInterface interface {
+	Create(*v1.ClusterHelmRepository) (*v1.ClusterHelmRepository, error)
+	Update(*v1.ClusterHelmRepository) (*v1.ClusterHelmRepository, error)
+	UpdateStatus(*v1.ClusterHelmRepository) (*v1.ClusterHelmRepository, error)
+	Delete(name string, options *meta_v1.DeleteOptions) error
+	DeleteCollection(options *meta_v1.DeleteOptions, listOptions meta_v1.ListOptions) error
+	Get(name string, options meta_v1.GetOptions) (*v1.ClusterHelmRepository, error)
+	List(opts meta_v1.ListOptions) (*v1.ClusterHelmRepositoryList, error)
+	Watch(opts meta_v1.ListOptions) (watch.Interface, error)
+	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1.ClusterHelmRepository, err error)
+	ClusterHelmRepositoryExpansion
+}
+
+// clusterHelmRepositories implements ClusterHelmRepositoryInterface
+type clusterHelmRepositories struct {
+	client rest.Interface
+}
+
+// newClusterHelmRepositories returns a ClusterHelmRepositories
+func newClusterHelmRepositories(c *HelmV1Client) *clusterHelmRepositories {
+	return &clusterHelmRepositories{
+		client: c.RESTClient(),
+	}
+}
+
+// Get takes name of the clusterHelmRepository, and returns the corresponding clusterHelmRepository object, and an error if there is any.
+func (c *clusterHelmRepositories) Get(name string, options meta_v1.GetOptions) (result *v1.ClusterHelmRepository, err error) {
+	result = &v1.ClusterHelmRepository{}
+	err = c.client.Get().
+		Resource("clusterhelmrepositories").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of ClusterHelmRepositories that match those selectors.
+func (c *clusterHelmRepositories) List(opts meta_v1.ListOptions) (result *v1.ClusterHelmRepositoryList, err error) {
+	result = &v1.ClusterHelmRepositoryList{}
+	err = c.client.Get().
+		Resource("clusterhelmrepositories").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested clusterHelmRepositories.
+func (c *clusterHelmRepositories) Watch(opts meta_v1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	return c.client.Get().
+		Resource("clusterhelmrepositories").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Watch()
+}
+
+// Create takes the representation of a clusterHelmRepository and creates it.  Returns the server's representation of the clusterHelmRepository, and an error, if there is any.
+func (c *clusterHelmRepositories) Create(clusterHelmRepository *v1.ClusterHelmRepository) (result *v1.ClusterHelmRepository, err error) {
+	result = &v1.ClusterHelmRepository{}
+	err = c.client.Post().
+		Resource("clusterhelmrepositories").
+		Body(clusterHelmRepository).
+		Do().
+		Into(result)
+	return
+}
+
+// Update takes the representation of a clusterHelmRepository and updates it. Returns the server's representation of the clusterHelmRepository, and an error, if there is any.
+func (c *clusterHelmRepositories) Update(clusterHelmRepository *v1.ClusterHelmRepository) (result *v1.ClusterHelmRepository, err error) {
+	result = &v1.ClusterHelmRepository{}
+	err = c.client.Put().
+		Resource("clusterhelmrepositories").
+		Name(clusterHelmRepository.Name).
+		Body(clusterHelmRepository).
+		Do().
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+
+func (c *clusterHelmRepositories) UpdateStatus(clusterHelmRepository *v1.ClusterHelmRepository) (result *v1.ClusterHelmRepository, err error) {
+	result = &v1.ClusterHelmRepository{}
+	err = c.client.Put().
+		Resource("clusterhelmrepositories").
+		Name(clusterHelmRepository.Name).
+		SubResource("status").
+		Body(clusterHelmRepository).
+		Do().
+		Into(result)
+	return
+}
+
+// Delete takes name of the clusterHelmRepository and deletes it. Returns an error if one occurs.
+func (c *clusterHelmRepositories) Delete(name string, options *meta_v1.DeleteOptions) error {
+	return c.client.Delete().
+		Resource("clusterhelmrepositories").
+		Name(name).
+		Body(options).
+		Do().
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *clusterHelmRepositories) DeleteCollection(options *meta_v1.DeleteOptions, listOptions meta_v1.ListOptions) error {
+	return c.client.Delete().
+		Resource("clusterhelmrepositories").
+		VersionedParams(&listOptions, scheme.ParameterCodec).
+		Body(options).
+		Do().
+		Error()
+}
+
+// Patch applies the patch and returns the patched clusterHelmRepository.
+func (c *clusterHelmRepositories) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1.ClusterHelmRepository, err error) {
+	result = &v1.ClusterHelmRepository{}
+	err = c.client.Patch(pt).
+		Resource("clusterhelmrepositories").
+		SubResource(subresources...).
+		Name(name).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
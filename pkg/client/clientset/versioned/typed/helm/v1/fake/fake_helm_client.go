@@ -25,10 +25,18 @@ type FakeHelmV1 struct {
 	*testing.Fake
 }
 
+func (c *FakeHelmV1) ClusterHelmRepositories() v1.ClusterHelmRepositoryInterface {
+	return &FakeClusterHelmRepositories{c}
+}
+
 func (c *FakeHelmV1) HelmReleases(namespace string) v1.HelmReleaseInterface {
 	return &FakeHelmReleases{c, namespace}
 }
 
+func (c *FakeHelmV1) HelmRepositories(namespace string) v1.HelmRepositoryInterface {
+	return &FakeHelmRepositories{c, namespace}
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeHelmV1) RESTClient() rest.Interface {
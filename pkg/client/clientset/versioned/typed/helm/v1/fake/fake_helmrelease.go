@@ -97,6 +97,18 @@ func (c *FakeHelmReleases) Update(helmRelease *helm_bitnami_com_v1.HelmRelease)
 	return obj.(*helm_bitnami_com_v1.HelmRelease), err
 }
 
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeHelmReleases) UpdateStatus(helmRelease *helm_bitnami_com_v1.HelmRelease) (*helm_bitnami_com_v1.HelmRelease, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(helmreleasesResource, "status", c.ns, helmRelease), &helm_bitnami_com_v1.HelmRelease{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*helm_bitnami_com_v1.HelmRelease), err
+}
+
 // Delete takes name of the helmRelease and deletes it. Returns an error if one occurs.
 func (c *FakeHelmReleases) Delete(name string, options *v1.DeleteOptions) error {
 	_, err := c.Fake.
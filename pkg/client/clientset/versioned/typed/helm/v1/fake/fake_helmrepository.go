@@ -0,0 +1,137 @@
+/*
+Copyright 2018 The helm-crd-controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fake
+
+import (
+	helm_bitnami_com_v1 "github.com/bitnami-labs/helm-crd/pkg/apis/helm.bitnami.com/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeHelmRepositories implements HelmRepositoryInterface
+type FakeHelmRepositories struct {
+	Fake *FakeHelmV1
+	ns   string
+}
+
+var helmrepositoriesResource = schema.GroupVersionResource{Group: "helm.bitnami.com", Version: "v1", Resource: "helmrepositories"}
+
+var helmrepositoriesKind = schema.GroupVersionKind{Group: "helm.bitnami.com", Version: "v1", Kind: "HelmRepository"}
+
+// Get takes name of the helmRepository, and returns the corresponding helmRepository object, and an error if there is any.
+func (c *FakeHelmRepositories) Get(name string, options v1.GetOptions) (result *helm_bitnami_com_v1.HelmRepository, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(helmrepositoriesResource, c.ns, name), &helm_bitnami_com_v1.HelmRepository{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*helm_bitnami_com_v1.HelmRepository), err
+}
+
+// List takes label and field selectors, and returns the list of HelmRepositories that match those selectors.
+func (c *FakeHelmRepositories) List(opts v1.ListOptions) (result *helm_bitnami_com_v1.HelmRepositoryList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(helmrepositoriesResource, helmrepositoriesKind, c.ns, opts), &helm_bitnami_com_v1.HelmRepositoryList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &helm_bitnami_com_v1.HelmRepositoryList{}
+	for _, item := range obj.(*helm_bitnami_com_v1.HelmRepositoryList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested helmRepositorys.
+func (c *FakeHelmRepositories) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(helmrepositoriesResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a helmRepository and creates it.  Returns the server's representation of the helmRepository, and an error, if there is any.
+func (c *FakeHelmRepositories) Create(helmRepository *helm_bitnami_com_v1.HelmRepository) (result *helm_bitnami_com_v1.HelmRepository, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(helmrepositoriesResource, c.ns, helmRepository), &helm_bitnami_com_v1.HelmRepository{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*helm_bitnami_com_v1.HelmRepository), err
+}
+
+// Update takes the representation of a helmRepository and updates it. Returns the server's representation of the helmRepository, and an error, if there is any.
+func (c *FakeHelmRepositories) Update(helmRepository *helm_bitnami_com_v1.HelmRepository) (result *helm_bitnami_com_v1.HelmRepository, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(helmrepositoriesResource, c.ns, helmRepository), &helm_bitnami_com_v1.HelmRepository{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*helm_bitnami_com_v1.HelmRepository), err
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeHelmRepositories) UpdateStatus(helmRepository *helm_bitnami_com_v1.HelmRepository) (*helm_bitnami_com_v1.HelmRepository, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(helmrepositoriesResource, "status", c.ns, helmRepository), &helm_bitnami_com_v1.HelmRepository{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*helm_bitnami_com_v1.HelmRepository), err
+}
+
+// Delete takes name of the helmRepository and deletes it. Returns an error if one occurs.
+func (c *FakeHelmRepositories) Delete(name string, options *v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteAction(helmrepositoriesResource, c.ns, name), &helm_bitnami_com_v1.HelmRepository{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeHelmRepositories) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(helmrepositoriesResource, c.ns, listOptions)
+
+	_, err := c.Fake.Invokes(action, &helm_bitnami_com_v1.HelmRepositoryList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched helmRepository.
+func (c *FakeHelmRepositories) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *helm_bitnami_com_v1.HelmRepository, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(helmrepositoriesResource, c.ns, name, data, subresources...), &helm_bitnami_com_v1.HelmRepository{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*helm_bitnami_com_v1.HelmRepository), err
+}
@@ -15,4 +15,8 @@ limitations under the License.
 */
 package v1
 
+type ClusterHelmRepositoryExpansion interface{}
+
 type HelmReleaseExpansion interface{}
+
+type HelmRepositoryExpansion interface{}
@@ -34,6 +34,7 @@ type HelmReleasesGetter interface {
 type HelmReleaseInterface interface {
 	Create(*v1.HelmRelease) (*v1.HelmRelease, error)
 	Update(*v1.HelmRelease) (*v1.HelmRelease, error)
+	UpdateStatus(*v1.HelmRelease) (*v1.HelmRelease, error)
 	Delete(name string, options *meta_v1.DeleteOptions) error
 	DeleteCollection(options *meta_v1.DeleteOptions, listOptions meta_v1.ListOptions) error
 	Get(name string, options meta_v1.GetOptions) (*v1.HelmRelease, error)
@@ -117,6 +118,22 @@ func (c *helmReleases) Update(helmRelease *v1.HelmRelease) (result *v1.HelmRelea
 	return
 }
 
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+
+func (c *helmReleases) UpdateStatus(helmRelease *v1.HelmRelease) (result *v1.HelmRelease, err error) {
+	result = &v1.HelmRelease{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("helmreleases").
+		Name(helmRelease.Name).
+		SubResource("status").
+		Body(helmRelease).
+		Do().
+		Into(result)
+	return
+}
+
 // Delete takes name of the helmRelease and deletes it. Returns an error if one occurs.
 func (c *helmReleases) Delete(name string, options *meta_v1.DeleteOptions) error {
 	return c.client.Delete().
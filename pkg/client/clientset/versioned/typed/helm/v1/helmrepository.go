@@ -0,0 +1,171 @@
+/*
+Copyright 2018 The helm-crd-controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1
+
+import (
+	v1 "github.com/bitnami-labs/helm-crd/pkg/apis/helm.bitnami.com/v1"
+	scheme "github.com/bitnami-labs/helm-crd/pkg/client/clientset/versioned/scheme"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// HelmRepositoriesGetter has a method to return a HelmRepositoryInterface.
+// A group's client should implement this interface.
+type HelmRepositoriesGetter interface {
+	HelmRepositories(namespace string) HelmRepositoryInterface
+}
+
+// HelmRepositoryInterface has methods to work with HelmRepository resources.
+type HelmRepositoryInterface interface {
+	Create(*v1.HelmRepository) (*v1.HelmRepository, error)
+	Update(*v1.HelmRepository) (*v1.HelmRepository, error)
+	UpdateStatus(*v1.HelmRepository) (*v1.HelmRepository, error)
+	Delete(name string, options *meta_v1.DeleteOptions) error
+	DeleteCollection(options *meta_v1.DeleteOptions, listOptions meta_v1.ListOptions) error
+	Get(name string, options meta_v1.GetOptions) (*v1.HelmRepository, error)
+	List(opts meta_v1.ListOptions) (*v1.HelmRepositoryList, error)
+	Watch(opts meta_v1.ListOptions) (watch.Interface, error)
+	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1.HelmRepository, err error)
+	HelmRepositoryExpansion
+}
+
+// helmRepositories implements HelmRepositoryInterface
+type helmRepositories struct {
+	client rest.Interface
+	ns     string
+}
+
+// newHelmRepositories returns a HelmRepositories
+func newHelmRepositories(c *HelmV1Client, namespace string) *helmRepositories {
+	return &helmRepositories{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the helmRepository, and returns the corresponding helmRepository object, and an error if there is any.
+func (c *helmRepositories) Get(name string, options meta_v1.GetOptions) (result *v1.HelmRepository, err error) {
+	result = &v1.HelmRepository{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("helmrepositories").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of HelmRepositories that match those selectors.
+func (c *helmRepositories) List(opts meta_v1.ListOptions) (result *v1.HelmRepositoryList, err error) {
+	result = &v1.HelmRepositoryList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("helmrepositories").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested helmRepositories.
+func (c *helmRepositories) Watch(opts meta_v1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("helmrepositories").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Watch()
+}
+
+// Create takes the representation of a helmRepository and creates it.  Returns the server's representation of the helmRepository, and an error, if there is any.
+func (c *helmRepositories) Create(helmRepository *v1.HelmRepository) (result *v1.HelmRepository, err error) {
+	result = &v1.HelmRepository{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("helmrepositories").
+		Body(helmRepository).
+		Do().
+		Into(result)
+	return
+}
+
+// Update takes the representation of a helmRepository and updates it. Returns the server's representation of the helmRepository, and an error, if there is any.
+func (c *helmRepositories) Update(helmRepository *v1.HelmRepository) (result *v1.HelmRepository, err error) {
+	result = &v1.HelmRepository{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("helmrepositories").
+		Name(helmRepository.Name).
+		Body(helmRepository).
+		Do().
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+
+func (c *helmRepositories) UpdateStatus(helmRepository *v1.HelmRepository) (result *v1.HelmRepository, err error) {
+	result = &v1.HelmRepository{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("helmrepositories").
+		Name(helmRepository.Name).
+		SubResource("status").
+		Body(helmRepository).
+		Do().
+		Into(result)
+	return
+}
+
+// Delete takes name of the helmRepository and deletes it. Returns an error if one occurs.
+func (c *helmRepositories) Delete(name string, options *meta_v1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("helmrepositories").
+		Name(name).
+		Body(options).
+		Do().
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *helmRepositories) DeleteCollection(options *meta_v1.DeleteOptions, listOptions meta_v1.ListOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("helmrepositories").
+		VersionedParams(&listOptions, scheme.ParameterCodec).
+		Body(options).
+		Do().
+		Error()
+}
+
+// Patch applies the patch and returns the patched helmRepository.
+func (c *helmRepositories) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1.HelmRepository, err error) {
+	result = &v1.HelmRepository{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("helmrepositories").
+		SubResource(subresources...).
+		Name(name).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
@@ -0,0 +1,205 @@
+package chart
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	archiveCacheExt       = ".tgz"
+	archiveCacheTmpPrefix = "tmp-"
+)
+
+var sha256Regexp = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// ArchiveCache stores downloaded chart archives in a directory, keyed
+// by their repository, credentials (Authorization header and TLS
+// client identity) and digest (or URL if they have none). The least recently used
+// archives are removed once the total size goes over a limit.
+type ArchiveCache struct {
+	dir     string
+	maxSize int64
+
+	mutex   sync.Mutex
+	size    int64
+	lru     *list.List // of *archiveCacheEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type archiveCacheEntry struct {
+	key  string
+	size int64
+}
+
+// NewArchiveCache returns an ArchiveCache storing up to maxSize bytes
+// in dir. Archives already in dir are kept, ordered by modification
+// time.
+func NewArchiveCache(dir string, maxSize int64) (*ArchiveCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	c := &ArchiveCache{
+		dir:     dir,
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: map[string]*list.Element{},
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().After(files[j].ModTime())
+	})
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), archiveCacheTmpPrefix) {
+			// Interrupted write
+			os.Remove(filepath.Join(dir, f.Name()))
+			continue
+		}
+		if f.IsDir() || !strings.HasSuffix(f.Name(), archiveCacheExt) {
+			continue
+		}
+		key := strings.TrimSuffix(f.Name(), archiveCacheExt)
+		c.entries[key] = c.lru.PushBack(&archiveCacheEntry{key: key, size: f.Size()})
+		c.size += f.Size()
+	}
+	c.evict()
+	return c, nil
+}
+
+// archiveCacheKey returns the key of an archive downloaded from the
+// repository at repoURL with authHeader and the TLS client identified
+// by tlsIdentity: a hash of these and of its sha256 digest as found in
+// repository indexes if valid, or of its URL. Archives are not shared
+// across repositories and credentials, so a HelmRelease can't read a
+// private chart of another one by giving its digest.
+func archiveCacheKey(repoURL, chartURL, digest, authHeader, tlsIdentity string) string {
+	digest = strings.TrimPrefix(strings.ToLower(digest), "sha256:")
+	if !sha256Regexp.MatchString(digest) {
+		digest = "url " + chartURL
+	}
+	h := sha256.New()
+	for _, s := range []string{repoURL, authHeader, tlsIdentity, digest} {
+		fmt.Fprintf(h, "%d:%s", len(s), s)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func (c *ArchiveCache) path(key string) string {
+	return filepath.Join(c.dir, key+archiveCacheExt)
+}
+
+// FetchChartArchive returns the chart archive at chartURL, of the
+// repository at repoURL, from the cache if present. Otherwise, it is
+// downloaded and stored in the cache. The archive must match digest,
+// if not empty. tlsIdentity identifies the TLS client certificate of
+// getter, as for IndexCache.Fetch.
+func (c *ArchiveCache) FetchChartArchive(getter Getter, repoURL, chartURL, digest, authHeader, tlsIdentity string) ([]byte, error) {
+	key := archiveCacheKey(repoURL, chartURL, digest, authHeader, tlsIdentity)
+	if data, ok := c.get(key); ok {
+		if VerifyDigest(data, digest) == nil {
+			return data, nil
+		}
+		// Corrupted archive, download it again
+		c.remove(key)
+	}
+
+	data, err := FetchChartArchive(getter, chartURL, digest, authHeader)
+	if err != nil {
+		return nil, err
+	}
+	// Not fatal if it fails, the archive is downloaded again next time
+	c.put(key, data)
+	return data, nil
+}
+
+func (c *ArchiveCache) get(key string) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		c.removeElement(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	// Keep the order across restarts
+	now := time.Now()
+	os.Chtimes(c.path(key), now, now)
+	return data, true
+}
+
+func (c *ArchiveCache) put(key string, data []byte) error {
+	size := int64(len(data))
+	if size > c.maxSize {
+		return fmt.Errorf("archive of %d bytes is larger than the cache", size)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	tmp, err := ioutil.TempFile(c.dir, archiveCacheTmpPrefix)
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*archiveCacheEntry)
+		c.size += size - entry.size
+		entry.size = size
+		c.lru.MoveToFront(elem)
+	} else {
+		c.entries[key] = c.lru.PushFront(&archiveCacheEntry{key: key, size: size})
+		c.size += size
+	}
+	c.evict()
+	return nil
+}
+
+func (c *ArchiveCache) remove(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// evict removes the least recently used archives until the cache size
+// is within the limit. Must be called with mutex held.
+func (c *ArchiveCache) evict() {
+	for c.size > c.maxSize {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+func (c *ArchiveCache) removeElement(elem *list.Element) {
+	entry := elem.Value.(*archiveCacheEntry)
+	os.Remove(c.path(entry.key))
+	c.lru.Remove(elem)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+}
@@ -0,0 +1,122 @@
+package chart
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeArchiveServer is an HTTPClient serving chart archives whose
+// content is their URL
+type fakeArchiveServer struct {
+	requests []string
+}
+
+func (f *fakeArchiveServer) Do(req *http.Request) (*http.Response, error) {
+	f.requests = append(f.requests, req.URL.String())
+	if strings.Contains(req.URL.Path, "missing") {
+		return &http.Response{StatusCode: 404, Body: ioutil.NopCloser(bytes.NewReader(nil))}, nil
+	}
+	return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(req.URL.String()))}, nil
+}
+
+func TestArchiveCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := &fakeArchiveServer{}
+	var netClient HTTPClient = server
+	getters := NewGetters(&netClient, "")
+	// Room for two archives of the URLs below
+	cache, err := NewArchiveCache(dir, 2*int64(len("http://charts.example.com/foo-1.0.0.tgz")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := fmt.Sprintf("%x", sha256.Sum256([]byte("http://charts.example.com/bar-1.0.0.tgz")))
+
+	const repoURL = "http://charts.example.com/"
+	fetch := func(chartURL, digest string, expectedRequests int) {
+		data, err := cache.FetchChartArchive(getters, repoURL, chartURL, digest, "", "")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if string(data) != chartURL {
+			t.Errorf("Expected chart %s received %s", chartURL, data)
+		}
+		if len(server.requests) != expectedRequests {
+			t.Errorf("Expected %d requests, received %v", expectedRequests, server.requests)
+		}
+	}
+
+	fetch("http://charts.example.com/foo-1.0.0.tgz", "", 1)
+	fetch("http://charts.example.com/foo-1.0.0.tgz", "", 1)
+	fetch("http://charts.example.com/bar-1.0.0.tgz", digest, 2)
+	if _, err := os.Stat(filepath.Join(dir, archiveCacheKey(repoURL, "", digest, "", "")+".tgz")); err != nil {
+		t.Errorf("Expected archive to be stored by digest: %v", err)
+	}
+	// Same digest, other URL
+	fetch("http://charts.example.com/bar-1.0.0.tgz", "sha256:"+strings.ToUpper(digest), 2)
+
+	// foo is the least recently used, and is evicted
+	fetch("http://charts.example.com/foo-1.0.0.tgz", "", 2)
+	fetch("http://charts.example.com/baz-1.0.0.tgz", "", 3)
+	fetch("http://charts.example.com/bar-1.0.0.tgz", digest, 4)
+	fetch("http://charts.example.com/baz-1.0.0.tgz", "", 4)
+
+	if _, err := cache.FetchChartArchive(getters, repoURL, "http://charts.example.com/missing-1.0.0.tgz", "", "", ""); err == nil {
+		t.Errorf("Expected error fetching missing chart")
+	}
+	if _, err := cache.FetchChartArchive(getters, repoURL, "http://charts.example.com/qux-1.0.0.tgz", strings.Repeat("ab", 32), "", ""); !IsVerificationError(err) {
+		t.Errorf("Expected verification error, received %v", err)
+	}
+
+	// Cached archives are kept across restarts
+	cache, err = NewArchiveCache(dir, cache.maxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.entries) != 2 || cache.size != cache.maxSize {
+		t.Errorf("Expected 2 cached archives, received %d (%d bytes)", len(cache.entries), cache.size)
+	}
+	fetch("http://charts.example.com/baz-1.0.0.tgz", "", 6)
+}
+
+func TestArchiveCacheKey(t *testing.T) {
+	digest := strings.Repeat("ab", 32)
+	key := archiveCacheKey("http://charts.example.com/", "http://charts.example.com/foo-1.0.0.tgz", digest, "Basic Zm9vOmJhcg==", "client-a")
+	if !sha256Regexp.MatchString(key) {
+		t.Errorf("Expected a sha256 key received %q", key)
+	}
+	if strings.Contains(key, digest) {
+		t.Errorf("Expected the digest to be hashed, received %q", key)
+	}
+
+	tests := []struct {
+		description                                        string
+		repoURL, chartURL, digest, authHeader, tlsIdentity string
+		sameKey                                            bool
+	}{
+		{"same archive", "http://charts.example.com/", "http://charts.example.com/foo-1.0.0.tgz", digest, "Basic Zm9vOmJhcg==", "client-a", true},
+		{"other URL, same digest", "http://charts.example.com/", "http://mirror.example.com/foo-1.0.0.tgz", "sha256:" + strings.ToUpper(digest), "Basic Zm9vOmJhcg==", "client-a", true},
+		{"other repository", "http://other.example.com/", "http://charts.example.com/foo-1.0.0.tgz", digest, "Basic Zm9vOmJhcg==", "client-a", false},
+		{"other credentials", "http://charts.example.com/", "http://charts.example.com/foo-1.0.0.tgz", digest, "Basic YmFyOmJheg==", "client-a", false},
+		{"no credentials", "http://charts.example.com/", "http://charts.example.com/foo-1.0.0.tgz", digest, "", "client-a", false},
+		{"other TLS client", "http://charts.example.com/", "http://charts.example.com/foo-1.0.0.tgz", digest, "Basic Zm9vOmJhcg==", "client-b", false},
+		{"no TLS client", "http://charts.example.com/", "http://charts.example.com/foo-1.0.0.tgz", digest, "Basic Zm9vOmJhcg==", "", false},
+		{"no digest", "http://charts.example.com/", "http://charts.example.com/foo-1.0.0.tgz", "", "Basic Zm9vOmJhcg==", "client-a", false},
+	}
+	for _, tt := range tests {
+		if k := archiveCacheKey(tt.repoURL, tt.chartURL, tt.digest, tt.authHeader, tt.tlsIdentity); (k == key) != tt.sameKey {
+			t.Errorf("%s: expected same key %v, received %q and %q", tt.description, tt.sameKey, key, k)
+		}
+	}
+}
@@ -63,17 +63,8 @@ func parseIndex(data []byte) (*repo.IndexFile, error) {
 }
 
 // FetchRepoIndex returns a Helm repository
-func FetchRepoIndex(netClient *HTTPClient, repoURL string, authHeader string) (*repo.IndexFile, error) {
-	req, err := getReq(repoURL, authHeader)
-	if err != nil {
-		return nil, err
-	}
-
-	res, err := (*netClient).Do(req)
-	if err != nil {
-		return nil, err
-	}
-	data, err := readResponseBody(res)
+func FetchRepoIndex(getter Getter, repoURL string, authHeader string) (*repo.IndexFile, error) {
+	data, err := getter.Get(repoURL, authHeader)
 	if err != nil {
 		return nil, err
 	}
@@ -93,39 +84,84 @@ func resolveChartURL(index, chart string) (string, error) {
 	return chartURL.String(), nil
 }
 
-// FindChartInRepoIndex returns the URL of a chart given a Helm repository and its name and version
-func FindChartInRepoIndex(repoIndex *repo.IndexFile, repoURL, chartName, chartVersion string) (string, error) {
+// FindChartVersionInRepoIndex returns the index entry of a chart given a Helm repository and its name and version.
+// The version can be a semver range, resolved to the newest matching version (see ResolveVersion).
+func FindChartVersionInRepoIndex(repoIndex *repo.IndexFile, chartName, chartVersion string, prereleases bool) (*repo.ChartVersion, error) {
 	errMsg := fmt.Sprintf("chart %q", chartName)
 	if chartVersion != "" {
 		errMsg = fmt.Sprintf("%s version %q", errMsg, chartVersion)
 	}
-	cv, err := repoIndex.Get(chartName, chartVersion)
+	var versions []string
+	for _, cv := range repoIndex.Entries[chartName] {
+		versions = append(versions, cv.Version)
+	}
+	version, err := ResolveVersion(versions, chartVersion, prereleases)
 	if err != nil {
-		return "", fmt.Errorf("%s not found in repository", errMsg)
+		return nil, fmt.Errorf("%s not found in repository", errMsg)
+	}
+	var cv *repo.ChartVersion
+	for _, entry := range repoIndex.Entries[chartName] {
+		if entry.Version == version {
+			cv = entry
+			break
+		}
 	}
 	if len(cv.URLs) == 0 {
-		return "", fmt.Errorf("%s has no downloadable URLs", errMsg)
+		return nil, fmt.Errorf("%s has no downloadable URLs", errMsg)
+	}
+	return cv, nil
+}
+
+// FindChartInRepoIndex returns the URL of a chart given a Helm repository and its name and version
+func FindChartInRepoIndex(repoIndex *repo.IndexFile, repoURL, chartName, chartVersion string) (string, error) {
+	cv, err := FindChartVersionInRepoIndex(repoIndex, chartName, chartVersion, false)
+	if err != nil {
+		return "", err
 	}
+	return ChartVersionURL(cv, repoURL)
+}
+
+// ChartVersionURL returns the URL of the archive of an index entry, resolved against repoURL
+func ChartVersionURL(cv *repo.ChartVersion, repoURL string) (string, error) {
 	return resolveChartURL(repoURL, cv.URLs[0])
 }
 
+// ChartVersionURLs returns the URLs of the archive of an index entry,
+// in the order they are listed, resolved against repoURL
+func ChartVersionURLs(cv *repo.ChartVersion, repoURL string) ([]string, error) {
+	urls := make([]string, 0, len(cv.URLs))
+	for _, u := range cv.URLs {
+		chartURL, err := resolveChartURL(repoURL, u)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, chartURL)
+	}
+	return urls, nil
+}
+
 // LoadChart should return a Chart struct from an IOReader
 type LoadChart func(in io.Reader) (*chart.Chart, error)
 
-// FetchChart returns the Chart content given an URL and the auth header if needed
-func FetchChart(netClient *HTTPClient, chartURL, authHeader string, load LoadChart) (*chart.Chart, error) {
-	req, err := getReq(chartURL, authHeader)
+// FetchChart returns the Chart content given an URL and the auth header if needed.
+// The archive must match digest, if not empty.
+func FetchChart(getter Getter, chartURL, digest, authHeader string, load LoadChart) (*chart.Chart, error) {
+	data, err := FetchChartArchive(getter, chartURL, digest, authHeader)
 	if err != nil {
 		return nil, err
 	}
+	return load(bytes.NewReader(data))
+}
 
-	res, err := (*netClient).Do(req)
+// FetchChartArchive returns the chart archive at chartURL, checking it
+// matches digest if not empty
+func FetchChartArchive(getter Getter, chartURL, digest, authHeader string) ([]byte, error) {
+	data, err := getter.Get(chartURL, authHeader)
 	if err != nil {
 		return nil, err
 	}
-	data, err := readResponseBody(res)
-	if err != nil {
+	if err := VerifyDigest(data, digest); err != nil {
 		return nil, err
 	}
-	return load(bytes.NewReader(data))
+	return data, nil
 }
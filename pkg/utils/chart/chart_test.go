@@ -2,6 +2,7 @@ package chart
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
@@ -74,3 +75,15 @@ func TestFindChartInRepoIndex(t *testing.T) {
 		t.Errorf("Expecting %s to be resolved as %s", res, expectedURL)
 	}
 }
+
+func TestChartVersionURLs(t *testing.T) {
+	cv := &repo.ChartVersion{URLs: []string{"foo-1.0.0.tgz", "https://mirror.example.com/foo-1.0.0.tgz"}}
+	urls, err := ChartVersionURLs(cv, "http://charts.example.com/repo/index.yaml")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected := []string{"http://charts.example.com/repo/foo-1.0.0.tgz", "https://mirror.example.com/foo-1.0.0.tgz"}
+	if !reflect.DeepEqual(urls, expected) {
+		t.Errorf("Expected %v received %v", expected, urls)
+	}
+}
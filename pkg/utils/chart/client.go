@@ -0,0 +1,67 @@
+package chart
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// NewHTTPClient returns an HTTPClient for a chart repository, using
+// tlsConfig (if not nil) for HTTPS connections
+func NewHTTPClient(timeout time.Duration, tlsConfig *tls.Config) HTTPClient {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSClientConfig:     tlsConfig,
+			TLSHandshakeTimeout: 10 * time.Second,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// TLSConfig returns the TLS configuration to connect to a chart
+// repository, given PEM encoded CA certificates and client certificate
+// and key. All of them are optional, nil is returned if none is given.
+func TLSConfig(caPEM, certPEM, keyPEM []byte) (*tls.Config, error) {
+	if len(caPEM) == 0 && len(certPEM) == 0 && len(keyPEM) == 0 {
+		return nil, nil
+	}
+
+	config := &tls.Config{}
+	if len(caPEM) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no valid CA certificates found")
+		}
+		config.RootCAs = pool
+	}
+	if len(certPEM) > 0 || len(keyPEM) > 0 {
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// BasicAuthHeader returns the Authorization header for basic
+// authentication
+func BasicAuthHeader(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+// BearerAuthHeader returns the Authorization header for bearer token
+// authentication
+func BearerAuthHeader(token string) string {
+	return "Bearer " + token
+}
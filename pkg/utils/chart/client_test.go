@@ -0,0 +1,128 @@
+package chart
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestCert returns a PEM encoded certificate and key, signed by
+// parent (self-signed if nil)
+func newTestCert(t *testing.T, cn string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func TestTLSConfig(t *testing.T) {
+	ca, caKey, _, _ := newTestCert(t, "client-ca", true, nil, nil)
+	_, _, certPEM, keyPEM := newTestCert(t, "client", false, ca, caKey)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	serverCAPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	tests := []struct {
+		name     string
+		ca       []byte
+		cert     []byte
+		key      []byte
+		expected string
+	}{
+		{"ca and client cert", serverCAPEM, certPEM, keyPEM, "client"},
+		{"no client cert", serverCAPEM, nil, nil, ""},
+		{"unknown ca", nil, certPEM, keyPEM, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := TLSConfig(tt.ca, tt.cert, tt.key)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			netClient := NewHTTPClient(10*time.Second, config)
+			req, err := getReq(server.URL, "")
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			res, err := netClient.Do(req)
+			if tt.expected == "" {
+				if err == nil {
+					res.Body.Close()
+					t.Errorf("Expected TLS error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			body, err := readResponseBody(res)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if string(body) != tt.expected {
+				t.Errorf("Expected %q received %q", tt.expected, body)
+			}
+		})
+	}
+
+	if config, err := TLSConfig(nil, nil, nil); config != nil || err != nil {
+		t.Errorf("Expected no TLS config, received %v %v", config, err)
+	}
+	if _, err := TLSConfig([]byte("not a certificate"), nil, nil); err == nil {
+		t.Errorf("Expected error with invalid CA")
+	}
+	if _, err := TLSConfig(nil, certPEM, nil); err == nil {
+		t.Errorf("Expected error with missing client key")
+	}
+}
+
+func TestBasicAuthHeader(t *testing.T) {
+	if h := BasicAuthHeader("user", "pass"); h != "Basic dXNlcjpwYXNz" {
+		t.Errorf("Unexpected header %s", h)
+	}
+}
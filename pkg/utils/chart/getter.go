@@ -0,0 +1,119 @@
+package chart
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// Getter downloads the content at a URL, such as a repository index
+// or a chart archive
+type Getter interface {
+	Get(rawURL, authHeader string) ([]byte, error)
+}
+
+// Getters dispatches requests to the Getter of their URL scheme. It is
+// itself a Getter.
+type Getters map[string]Getter
+
+// NewGetters returns the Getters for a chart repository: http and
+// https URLs are requested with netClient, and file URLs are read from
+// fileRoot. File URLs are not supported if fileRoot is empty.
+func NewGetters(netClient *HTTPClient, fileRoot string) Getters {
+	httpGetter := &HTTPGetter{Client: netClient}
+	getters := Getters{"http": httpGetter, "https": httpGetter}
+	if fileRoot != "" {
+		getters["file"] = &FileGetter{Root: fileRoot}
+	}
+	return getters
+}
+
+// For returns the Getter of the scheme of rawURL
+func (g Getters) For(rawURL string) (Getter, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, err
+	}
+	getter, ok := g[strings.ToLower(u.Scheme)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported URL scheme %q in %s", u.Scheme, rawURL)
+	}
+	return getter, nil
+}
+
+// Get returns the content at rawURL, using the Getter of its scheme
+func (g Getters) Get(rawURL, authHeader string) ([]byte, error) {
+	getter, err := g.For(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return getter.Get(rawURL, authHeader)
+}
+
+// HTTPGetter requests http and https URLs
+type HTTPGetter struct {
+	Client *HTTPClient
+}
+
+// Get returns the body of a successful GET request
+func (g *HTTPGetter) Get(rawURL, authHeader string) ([]byte, error) {
+	res, err := g.do(rawURL, authHeader, nil)
+	if err != nil {
+		return nil, err
+	}
+	return readResponseBody(res)
+}
+
+func (g *HTTPGetter) do(rawURL, authHeader string, header http.Header) (*http.Response, error) {
+	req, err := getReq(rawURL, authHeader)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return (*g.Client).Do(req)
+}
+
+// FileGetter reads file URLs (eg: file:///charts/index.yaml), which
+// must be under a root directory
+type FileGetter struct {
+	Root string
+}
+
+// Get returns the content of the file. Authorization headers are
+// ignored.
+func (g *FileGetter) Get(rawURL, authHeader string) ([]byte, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "file" || (u.Host != "" && u.Host != "localhost") {
+		return nil, fmt.Errorf("invalid file URL %s", rawURL)
+	}
+	p, err := g.path(u.Path)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(p)
+}
+
+// path returns the path of a file under the root directory, with
+// symlinks resolved
+func (g *FileGetter) path(p string) (string, error) {
+	root, err := filepath.EvalSymlinks(g.Root)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.FromSlash(p))
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is not under %s", p, g.Root)
+	}
+	return resolved, nil
+}
@@ -0,0 +1,72 @@
+package chart
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "getters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "charts")
+	if err := os.MkdirAll(filepath.Join(root, "stable"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{
+		"charts/stable/index.yaml": "index",
+		"secret":                   "secret",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, "secret"), filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	var netClient HTTPClient = &fakeArchiveServer{}
+	getters := NewGetters(&netClient, root)
+
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{"http", "http://charts.example.com/foo-1.0.0.tgz", "http://charts.example.com/foo-1.0.0.tgz"},
+		{"http not found", "http://charts.example.com/missing-1.0.0.tgz", ""},
+		{"file", "file://" + root + "/stable/index.yaml", "index"},
+		{"file localhost", "file://localhost" + root + "/stable/index.yaml", "index"},
+		{"file not found", "file://" + root + "/stable/other.yaml", ""},
+		{"file outside of root", "file://" + root + "/../secret", ""},
+		{"file symlink outside of root", "file://" + root + "/link", ""},
+		{"file remote host", "file://example.com" + root + "/stable/index.yaml", ""},
+		{"unsupported scheme", "ftp://charts.example.com/foo-1.0.0.tgz", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := getters.Get(tt.url, "")
+			if tt.expected == "" {
+				if err == nil {
+					t.Errorf("Expected error, received %q", data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if string(data) != tt.expected {
+				t.Errorf("Expected %q received %q", tt.expected, data)
+			}
+		})
+	}
+
+	// File URLs are disabled without a root
+	if _, err := NewGetters(&netClient, "").Get("file://"+root+"/stable/index.yaml", ""); err == nil {
+		t.Errorf("Expected error for a file URL without root")
+	}
+}
@@ -0,0 +1,378 @@
+package chart
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+const (
+	// Remote refs are fetched under their own namespace, so that
+	// branches and tags with the same name don't clash
+	gitRemoteHead     = "refs/remotes/origin/HEAD"
+	gitRemoteBranches = "refs/remotes/origin/heads/"
+	gitTags           = "refs/tags/"
+	// Transports git may use, excluding local repositories, ext:: and
+	// other helpers
+	gitAllowedProtocols = "http:https:ssh:git"
+)
+
+var gitCommitRegexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// IsGitCommit returns true if ref is a full commit SHA
+func IsGitCommit(ref string) bool {
+	return gitCommitRegexp.MatchString(ref)
+}
+
+// GitAuth holds the credentials to access a git repository
+type GitAuth struct {
+	// AuthHeader is the Authorization header sent to http(s) repositories
+	AuthHeader string
+	// CAPEM, CertPEM and KeyPEM are the PEM encoded CA certificates,
+	// client certificate and key for https repositories
+	CAPEM, CertPEM, KeyPEM []byte
+	// SSHKey is the private key for ssh repositories, whose host keys
+	// must be in KnownHosts
+	SSHKey, KnownHosts []byte
+}
+
+// GitCache keeps bare clones of git repositories in a directory,
+// fetched again whenever they are used. Each repository has a clone
+// per set of credentials, so commits fetched with some credentials are
+// never served to callers without them. Git commands are run with the
+// git binary.
+type GitCache struct {
+	dir     string
+	timeout time.Duration
+	// allowLocal allows local repositories, which other tenants'
+	// clones in dir would be. Only set by tests.
+	allowLocal bool
+
+	mutex sync.Mutex
+	// locks serializes the use of each clone
+	locks map[string]*sync.Mutex
+}
+
+// NewGitCache returns a GitCache storing clones in dir. Git commands
+// time out after timeout.
+func NewGitCache(dir string, timeout time.Duration) (*GitCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &GitCache{dir: dir, timeout: timeout, locks: map[string]*sync.Mutex{}}, nil
+}
+
+// Resolve fetches the repository at repoURL and returns the commit ref
+// (a branch, tag or commit) points to. An empty ref is the remote
+// HEAD.
+func (c *GitCache) Resolve(repoURL, ref string, auth *GitAuth) (string, error) {
+	dir, unlock, err := c.lock(repoURL, auth)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	if err := c.fetch(dir, repoURL, auth); err != nil {
+		return "", err
+	}
+	return c.resolve(dir, ref)
+}
+
+// FetchChart fetches the repository at repoURL and loads the chart in
+// directory chartPath at ref (see Resolve). It also returns the commit
+// the chart was loaded from. Commits already fetched with the same
+// credentials aren't fetched again.
+func (c *GitCache) FetchChart(repoURL, ref, chartPath string, auth *GitAuth) (*chart.Chart, string, error) {
+	chartPath = strings.Trim(path.Clean("/"+chartPath), "/")
+
+	dir, unlock, err := c.lock(repoURL, auth)
+	if err != nil {
+		return nil, "", err
+	}
+	defer unlock()
+
+	commit := ""
+	if IsGitCommit(ref) {
+		commit, _ = c.resolve(dir, ref)
+	}
+	if commit == "" {
+		if err := c.fetch(dir, repoURL, auth); err != nil {
+			return nil, "", err
+		}
+		if commit, err = c.resolve(dir, ref); err != nil {
+			return nil, "", err
+		}
+	}
+
+	tmp, err := ioutil.TempDir("", "helm-crd-git-chart")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.RemoveAll(tmp)
+	treeish := commit
+	if chartPath != "" {
+		treeish = commit + ":" + chartPath
+	}
+	archive, err := c.git(dir, nil, "archive", "--format=tar", treeish)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := extractTar(bytes.NewReader(archive), tmp); err != nil {
+		return nil, "", err
+	}
+	ch, err := chartutil.LoadDir(tmp)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to load chart from %s at commit %s: %v", chartPath, commit, err)
+	}
+	return ch, commit, nil
+}
+
+// lock returns the directory of the clone of repoURL fetched with
+// auth, creating it if needed, locked until unlock is called
+func (c *GitCache) lock(repoURL string, auth *GitAuth) (dir string, unlock func(), err error) {
+	if err := c.checkURL(repoURL); err != nil {
+		return "", nil, err
+	}
+	dir = filepath.Join(c.dir, gitCloneName(repoURL, auth))
+
+	c.mutex.Lock()
+	l, ok := c.locks[dir]
+	if !ok {
+		l = &sync.Mutex{}
+		c.locks[dir] = l
+	}
+	c.mutex.Unlock()
+
+	l.Lock()
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); os.IsNotExist(err) {
+		if _, err := c.git(c.dir, nil, "init", "--bare", "--quiet", dir); err != nil {
+			l.Unlock()
+			return "", nil, err
+		}
+	}
+	return dir, l.Unlock, nil
+}
+
+// gitCloneName returns the name of the clone of repoURL fetched with
+// auth: a hash of both
+func gitCloneName(repoURL string, auth *GitAuth) string {
+	if auth == nil {
+		auth = &GitAuth{}
+	}
+	h := sha256.New()
+	for _, b := range [][]byte{[]byte(repoURL), []byte(auth.AuthHeader), auth.CAPEM, auth.CertPEM, auth.KeyPEM, auth.SSHKey, auth.KnownHosts} {
+		fmt.Fprintf(h, "%d:", len(b))
+		h.Write(b)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// checkURL returns an error unless repoURL is an http, https, ssh or
+// git URL. Local paths, file URLs and scp-like addresses (which are
+// hard to tell from local paths) are rejected.
+func (c *GitCache) checkURL(repoURL string) error {
+	if repoURL == "" || strings.HasPrefix(repoURL, "-") {
+		return fmt.Errorf("invalid git repository URL %q", repoURL)
+	}
+	if c.allowLocal {
+		return nil
+	}
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return fmt.Errorf("invalid git repository URL %q: %v", repoURL, err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "ssh", "git":
+		if u.Host == "" {
+			return fmt.Errorf("invalid git repository URL %q: missing host", repoURL)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported git repository URL %q, expected an http, https, ssh or git URL", repoURL)
+}
+
+// fetch updates the remote HEAD, branches and tags of the clone in dir
+func (c *GitCache) fetch(dir, repoURL string, auth *GitAuth) error {
+	// Credentials are passed in the configuration of a temporary home,
+	// rather than in arguments visible to other processes
+	home, err := ioutil.TempDir("", "helm-crd-git-home")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(home)
+	env, err := gitAuthEnv(home, auth)
+	if err != nil {
+		return err
+	}
+	_, err = c.git(dir, env, "fetch", "--quiet", "--force", "--prune", "--no-tags", "--", repoURL,
+		"+HEAD:"+gitRemoteHead,
+		"+refs/heads/*:"+gitRemoteBranches+"*",
+		"+refs/tags/*:"+gitTags+"*")
+	return err
+}
+
+// resolve returns the commit of ref in the clone in dir
+func (c *GitCache) resolve(dir, ref string) (string, error) {
+	if strings.HasPrefix(ref, "-") {
+		return "", fmt.Errorf("invalid git ref %q", ref)
+	}
+	candidates := []string{gitRemoteHead}
+	if ref != "" {
+		candidates = []string{gitRemoteBranches + ref, gitTags + ref, ref}
+	}
+	for _, candidate := range candidates {
+		out, err := c.git(dir, nil, "rev-parse", "--verify", "--quiet", candidate+"^{commit}")
+		if err == nil {
+			return strings.TrimSpace(string(out)), nil
+		}
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	return "", fmt.Errorf("git ref %q not found", ref)
+}
+
+// git runs a git command in dir, with the environment variables in
+// env, and returns its output
+func (c *GitCache) git(dir string, env []string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append([]string{
+		"PATH=" + os.Getenv("PATH"),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_ALLOW_PROTOCOL=" + c.allowedProtocols(),
+	}, env...)
+	if len(env) == 0 {
+		// No user configuration either
+		cmd.Env = append(cmd.Env, "HOME="+os.DevNull)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// allowedProtocols returns the transports git may use
+func (c *GitCache) allowedProtocols() string {
+	if c.allowLocal {
+		return gitAllowedProtocols + ":file"
+	}
+	return gitAllowedProtocols
+}
+
+// gitAuthEnv writes the credentials in auth to home, as git
+// configuration and ssh files, and returns the environment variables
+// using them
+func gitAuthEnv(home string, auth *GitAuth) ([]string, error) {
+	if auth == nil {
+		auth = &GitAuth{}
+	}
+	var config bytes.Buffer
+	config.WriteString("[http]\n")
+	if auth.AuthHeader != "" {
+		if strings.ContainsAny(auth.AuthHeader, "\r\n") {
+			return nil, fmt.Errorf("invalid Authorization header")
+		}
+		fmt.Fprintf(&config, "\textraHeader = %s\n", gitConfigValue("Authorization: "+auth.AuthHeader))
+	}
+	for _, f := range []struct {
+		name, option string
+		data         []byte
+	}{
+		{"ca.crt", "sslCAInfo", auth.CAPEM},
+		{"tls.crt", "sslCert", auth.CertPEM},
+		{"tls.key", "sslKey", auth.KeyPEM},
+	} {
+		if len(f.data) == 0 {
+			continue
+		}
+		p := filepath.Join(home, f.name)
+		if err := ioutil.WriteFile(p, f.data, 0600); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&config, "\t%s = %s\n", f.option, gitConfigValue(p))
+	}
+	if err := ioutil.WriteFile(filepath.Join(home, ".gitconfig"), config.Bytes(), 0600); err != nil {
+		return nil, err
+	}
+	env := []string{"HOME=" + home}
+
+	if len(auth.SSHKey) > 0 {
+		if len(auth.KnownHosts) == 0 {
+			return nil, fmt.Errorf("known hosts are required with an ssh key")
+		}
+		key, knownHosts := filepath.Join(home, "identity"), filepath.Join(home, "known_hosts")
+		if err := ioutil.WriteFile(key, auth.SSHKey, 0600); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(knownHosts, auth.KnownHosts, 0600); err != nil {
+			return nil, err
+		}
+		env = append(env, fmt.Sprintf("GIT_SSH_COMMAND=ssh -F /dev/null -i %s -o IdentitiesOnly=yes -o UserKnownHostsFile=%s -o StrictHostKeyChecking=yes", key, knownHosts))
+	}
+	return env, nil
+}
+
+// gitConfigValue quotes a value for a git configuration file
+func gitConfigValue(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// extractTar extracts the directories and regular files of a tar
+// archive into dir. Other entries, like symlinks, are skipped.
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.FromSlash(path.Clean("/" + hdr.Name))
+		target := filepath.Join(dir, name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
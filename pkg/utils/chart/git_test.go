@@ -0,0 +1,267 @@
+package chart
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gitTestRepo is a bare repository pushed to from a work tree
+type gitTestRepo struct {
+	t    *testing.T
+	url  string
+	work string
+}
+
+func newGitTestRepo(t *testing.T, dir string) *gitTestRepo {
+	r := &gitTestRepo{t: t, url: filepath.Join(dir, "remote.git"), work: filepath.Join(dir, "work")}
+	r.run(dir, "init", "--bare", "--quiet", r.url)
+	r.run(dir, "init", "--quiet", r.work)
+	r.run(r.work, "checkout", "--quiet", "-b", "master")
+	return r
+}
+
+func (r *gitTestRepo) run(dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("git %s failed: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commit writes a chart of the given version under charts/foo,
+// commits and pushes it, and returns the commit
+func (r *gitTestRepo) commit(version string) string {
+	dir := filepath.Join(r.work, "charts", "foo")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		r.t.Fatal(err)
+	}
+	chartfile := "apiVersion: v1\nname: foo\nversion: " + version + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte(chartfile), 0644); err != nil {
+		r.t.Fatal(err)
+	}
+	r.run(r.work, "add", "-A")
+	r.run(r.work, "commit", "--quiet", "-m", version)
+	r.run(r.work, "push", "--quiet", "--force", "--tags", r.url, "HEAD:master")
+	return r.run(r.work, "rev-parse", "HEAD")
+}
+
+func TestGitCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	repo := newGitTestRepo(t, dir)
+	first := repo.commit("1.0.0")
+	repo.run(repo.work, "tag", "v1.0.0")
+	repo.run(repo.work, "push", "--quiet", repo.url, "v1.0.0")
+	second := repo.commit("1.1.0")
+
+	cache, err := NewGitCache(filepath.Join(dir, "cache"), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.allowLocal = true
+
+	tests := []struct {
+		name    string
+		ref     string
+		path    string
+		commit  string
+		version string
+	}{
+		{"HEAD", "", "charts/foo", second, "1.1.0"},
+		{"branch", "master", "/charts/foo/", second, "1.1.0"},
+		{"tag", "v1.0.0", "charts/foo", first, "1.0.0"},
+		{"commit", first, "charts/foo", first, "1.0.0"},
+		{"unknown ref", "other", "charts/foo", "", ""},
+		{"option ref", "--upload-pack=touch", "charts/foo", "", ""},
+		{"not a chart", "", "charts", "", ""},
+		{"unknown path", "", "charts/bar", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch, commit, err := cache.FetchChart(repo.url, tt.ref, tt.path, nil)
+			if tt.commit == "" {
+				if err == nil {
+					t.Errorf("Expected error, received commit %s", commit)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if commit != tt.commit {
+				t.Errorf("Expected commit %s received %s", tt.commit, commit)
+			}
+			if v := ch.GetMetadata().GetVersion(); v != tt.version {
+				t.Errorf("Expected version %s received %s", tt.version, v)
+			}
+		})
+	}
+
+	// New commits are fetched
+	third := repo.commit("1.2.0")
+	commit, err := cache.Resolve(repo.url, "master", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if commit != third {
+		t.Errorf("Expected commit %s received %s", third, commit)
+	}
+
+	if _, _, err := cache.FetchChart(filepath.Join(dir, "missing.git"), "", "", nil); err == nil {
+		t.Errorf("Expected error for a missing repository")
+	}
+}
+
+func TestGitCacheURLs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	repo := newGitTestRepo(t, dir)
+	repo.commit("1.0.0")
+
+	cache, err := NewGitCache(filepath.Join(dir, "cache"), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://github.com/example/charts.git", true},
+		{"http://git.example.com/charts.git", true},
+		{"ssh://git@github.com/example/charts.git", true},
+		{"git://git.example.com/charts.git", true},
+		{"", false},
+		{"--upload-pack=touch", false},
+		{repo.url, false},
+		{"file://" + repo.url, false},
+		{"git@github.com:example/charts.git", false},
+		{"ext::sh -c touch", false},
+		{"https:///charts.git", false},
+	}
+	for _, tt := range tests {
+		if err := cache.checkURL(tt.url); (err == nil) != tt.valid {
+			t.Errorf("Expected valid %v for %q, received error %v", tt.valid, tt.url, err)
+		}
+	}
+
+	// Local repositories can't be fetched, including clones in the cache
+	if _, err := cache.Resolve(repo.url, "", nil); err == nil {
+		t.Errorf("Expected error fetching a local repository")
+	}
+	cache.allowLocal = true
+	if _, err := cache.Resolve(repo.url, "", nil); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	cache.allowLocal = false
+	clone := filepath.Join(cache.dir, gitCloneName(repo.url, nil))
+	for _, u := range []string{clone, "file://" + clone} {
+		if _, _, err := cache.FetchChart(u, "", "charts/foo", nil); err == nil {
+			t.Errorf("Expected error fetching %s", u)
+		}
+	}
+}
+
+func TestGitCacheCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	repo := newGitTestRepo(t, dir)
+	commit := repo.commit("1.0.0")
+
+	// A private repository served over http
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := &cgi.Handler{
+		Path: gitPath,
+		Args: []string{"http-backend"},
+		Env:  []string{"GIT_PROJECT_ROOT=" + dir, "GIT_HTTP_EXPORT_ALL=1"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cr3t" {
+			http.Error(w, "unauthorized", http.StatusForbidden)
+			return
+		}
+		backend.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	repoURL := server.URL + "/remote.git"
+
+	cache, err := NewGitCache(filepath.Join(dir, "cache"), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, fetched, err := cache.FetchChart(repoURL, commit, "charts/foo", &GitAuth{AuthHeader: "Bearer s3cr3t"}); err != nil || fetched != commit {
+		t.Fatalf("Expected commit %s, received %s, %v", commit, fetched, err)
+	}
+	// The commit is in the clone, but other credentials must fetch it
+	// themselves
+	for _, auth := range []*GitAuth{nil, {AuthHeader: "Bearer other"}} {
+		if _, _, err := cache.FetchChart(repoURL, commit, "charts/foo", auth); err == nil {
+			t.Errorf("Expected error fetching the private commit with %+v", auth)
+		}
+		if _, err := cache.Resolve(repoURL, "master", auth); err == nil {
+			t.Errorf("Expected error resolving the private branch with %+v", auth)
+		}
+	}
+}
+
+func TestGitAuthEnv(t *testing.T) {
+	home, err := ioutil.TempDir("", "git-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	env, err := gitAuthEnv(home, &GitAuth{AuthHeader: `Basic "foo"`, CAPEM: []byte("ca")})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(env) != 1 || env[0] != "HOME="+home {
+		t.Errorf("Unexpected environment %v", env)
+	}
+	config, err := ioutil.ReadFile(filepath.Join(home, ".gitconfig"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[http]\n\textraHeader = \"Authorization: Basic \\\"foo\\\"\"\n\tsslCAInfo = \"" + filepath.Join(home, "ca.crt") + "\"\n"
+	if string(config) != expected {
+		t.Errorf("Expected config %q received %q", expected, config)
+	}
+
+	if _, err := gitAuthEnv(home, &GitAuth{AuthHeader: "Basic foo\n[core]"}); err == nil {
+		t.Errorf("Expected error for a multi-line header")
+	}
+	if _, err := gitAuthEnv(home, &GitAuth{SSHKey: []byte("key")}); err == nil {
+		t.Errorf("Expected error for an ssh key without known hosts")
+	}
+	env, err = gitAuthEnv(home, &GitAuth{SSHKey: []byte("key"), KnownHosts: []byte("host")})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(env) != 2 || !strings.HasPrefix(env[1], "GIT_SSH_COMMAND=ssh ") {
+		t.Errorf("Unexpected environment %v", env)
+	}
+}
@@ -0,0 +1,228 @@
+package chart
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/helm/pkg/repo"
+)
+
+// Maximum number of indexes kept by an IndexCache. Entries of rotated
+// credentials are never requested again, so the least recently
+// validated ones are dropped.
+const maxIndexCacheEntries = 128
+
+// IndexCache caches parsed repository indexes by repository URL and
+// credentials: Authorization header and TLS client identity. Cached indexes are used for up to a maximum age, then
+// revalidated with a conditional request (If-None-Match and
+// If-Modified-Since). Concurrent requests for the same index share a
+// single download.
+type IndexCache struct {
+	// Accessed atomically, first for 64-bit alignment
+	hits, misses, revalidations, errors uint64
+
+	maxAge time.Duration
+	now    func() time.Time
+
+	// OnDownload, if set, is called after each request for an index,
+	// with its duration and error
+	OnDownload func(repoURL string, duration time.Duration, err error)
+
+	mutex   sync.Mutex
+	entries map[string]*indexCacheEntry
+	calls   map[string]*indexCall
+}
+
+type indexCacheEntry struct {
+	index        *repo.IndexFile
+	etag         string
+	lastModified string
+	validated    time.Time
+}
+
+// indexCall is a download in progress, waited for by dups other
+// requests for the same index
+type indexCall struct {
+	wg    sync.WaitGroup
+	index *repo.IndexFile
+	err   error
+	dups  int
+}
+
+// IndexCacheStats are the counters of an IndexCache
+type IndexCacheStats struct {
+	// Hits is the number of indexes served without a request of
+	// their own, from the cache or from a concurrent request
+	Hits uint64
+	// Misses is the number of indexes downloaded in full
+	Misses uint64
+	// Revalidations is the number of cached indexes confirmed to be
+	// up to date by the repository
+	Revalidations uint64
+	// Errors is the number of failed requests
+	Errors uint64
+}
+
+// NewIndexCache returns an IndexCache that revalidates indexes older
+// than maxAge. With a zero maxAge, indexes are revalidated every time.
+func NewIndexCache(maxAge time.Duration) *IndexCache {
+	return &IndexCache{
+		maxAge:  maxAge,
+		now:     time.Now,
+		entries: map[string]*indexCacheEntry{},
+		calls:   map[string]*indexCall{},
+	}
+}
+
+func indexCacheKey(repoURL, authHeader, tlsIdentity string) string {
+	// Don't keep credentials around as map keys
+	h := sha256.New()
+	for _, s := range []string{authHeader, tlsIdentity} {
+		fmt.Fprintf(h, "%d:%s", len(s), s)
+	}
+	return fmt.Sprintf("%s %x", repoURL, h.Sum(nil))
+}
+
+// Fetch returns the index at repoURL, from the cache if it is not
+// older than the maximum age. tlsIdentity identifies the TLS client
+// certificate of getter (eg: a hash of it), "" if it has none, so that
+// the indexes of repositories requiring one aren't shared with other
+// clients.
+func (c *IndexCache) Fetch(getter Getter, repoURL, authHeader, tlsIdentity string) (*repo.IndexFile, error) {
+	return c.fetch(getter, repoURL, authHeader, tlsIdentity, false)
+}
+
+// Refresh returns the index at repoURL, revalidating the cached index
+// regardless of its age
+func (c *IndexCache) Refresh(getter Getter, repoURL, authHeader, tlsIdentity string) (*repo.IndexFile, error) {
+	return c.fetch(getter, repoURL, authHeader, tlsIdentity, true)
+}
+
+// Stats returns the counters of the cache
+func (c *IndexCache) Stats() IndexCacheStats {
+	return IndexCacheStats{
+		Hits:          atomic.LoadUint64(&c.hits),
+		Misses:        atomic.LoadUint64(&c.misses),
+		Revalidations: atomic.LoadUint64(&c.revalidations),
+		Errors:        atomic.LoadUint64(&c.errors),
+	}
+}
+
+func (c *IndexCache) fetch(getter Getter, repoURL, authHeader, tlsIdentity string, refresh bool) (*repo.IndexFile, error) {
+	key := indexCacheKey(repoURL, authHeader, tlsIdentity)
+
+	c.mutex.Lock()
+	entry := c.entries[key]
+	if entry != nil && !refresh && c.now().Sub(entry.validated) < c.maxAge {
+		c.mutex.Unlock()
+		atomic.AddUint64(&c.hits, 1)
+		return entry.index, nil
+	}
+	if call, ok := c.calls[key]; ok {
+		call.dups++
+		c.mutex.Unlock()
+		atomic.AddUint64(&c.hits, 1)
+		call.wg.Wait()
+		return call.index, call.err
+	}
+	call := &indexCall{}
+	call.wg.Add(1)
+	c.calls[key] = call
+	c.mutex.Unlock()
+
+	start := time.Now()
+	call.index, call.err = c.download(getter, key, repoURL, authHeader, entry)
+	if c.OnDownload != nil {
+		c.OnDownload(repoURL, time.Since(start), call.err)
+	}
+	call.wg.Done()
+
+	c.mutex.Lock()
+	delete(c.calls, key)
+	c.mutex.Unlock()
+	return call.index, call.err
+}
+
+// download requests the index, conditionally if a cached entry is
+// given and it is served over HTTP, and updates the cache
+func (c *IndexCache) download(getter Getter, key, repoURL, authHeader string, entry *indexCacheEntry) (*repo.IndexFile, error) {
+	if getters, ok := getter.(Getters); ok {
+		var err error
+		if getter, err = getters.For(repoURL); err != nil {
+			atomic.AddUint64(&c.errors, 1)
+			return nil, err
+		}
+	}
+
+	var data []byte
+	var etag, lastModified string
+	var err error
+	if httpGetter, ok := getter.(*HTTPGetter); ok {
+		header := http.Header{}
+		if entry != nil {
+			if entry.etag != "" {
+				header.Set("If-None-Match", entry.etag)
+			}
+			if entry.lastModified != "" {
+				header.Set("If-Modified-Since", entry.lastModified)
+			}
+		}
+		var res *http.Response
+		res, err = httpGetter.do(repoURL, authHeader, header)
+		if err != nil {
+			atomic.AddUint64(&c.errors, 1)
+			return nil, err
+		}
+		if entry != nil && res.StatusCode == http.StatusNotModified {
+			res.Body.Close()
+			atomic.AddUint64(&c.revalidations, 1)
+			c.store(key, &indexCacheEntry{
+				index:        entry.index,
+				etag:         entry.etag,
+				lastModified: entry.lastModified,
+				validated:    c.now(),
+			})
+			return entry.index, nil
+		}
+		etag, lastModified = res.Header.Get("ETag"), res.Header.Get("Last-Modified")
+		data, err = readResponseBody(res)
+	} else {
+		data, err = getter.Get(repoURL, authHeader)
+	}
+	if err != nil {
+		atomic.AddUint64(&c.errors, 1)
+		return nil, err
+	}
+	index, err := parseIndex(data)
+	if err != nil {
+		atomic.AddUint64(&c.errors, 1)
+		return nil, err
+	}
+	atomic.AddUint64(&c.misses, 1)
+	c.store(key, &indexCacheEntry{
+		index:        index,
+		etag:         etag,
+		lastModified: lastModified,
+		validated:    c.now(),
+	})
+	return index, nil
+}
+
+func (c *IndexCache) store(key string, entry *indexCacheEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxIndexCacheEntries {
+		var oldest string
+		for k, e := range c.entries {
+			if oldest == "" || e.validated.Before(c.entries[oldest].validated) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+	c.entries[key] = entry
+}
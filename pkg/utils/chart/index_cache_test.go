@@ -0,0 +1,186 @@
+package chart
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeIndexServer is an HTTPClient serving a repository index with an
+// ETag, optionally blocking requests until release is closed
+type fakeIndexServer struct {
+	mutex    sync.Mutex
+	index    string
+	etag     string
+	requests []*http.Request
+	release  chan struct{}
+}
+
+func (f *fakeIndexServer) Do(req *http.Request) (*http.Response, error) {
+	f.mutex.Lock()
+	f.requests = append(f.requests, req)
+	index, etag, release := f.index, f.etag, f.release
+	f.mutex.Unlock()
+	if release != nil {
+		<-release
+	}
+
+	if req.URL.String() != "http://charts.example.com/index.yaml" {
+		return &http.Response{StatusCode: 404, Body: ioutil.NopCloser(bytes.NewReader(nil))}, nil
+	}
+	header := http.Header{}
+	header.Set("ETag", etag)
+	if req.Header.Get("If-None-Match") == etag {
+		return &http.Response{StatusCode: http.StatusNotModified, Header: header, Body: ioutil.NopCloser(bytes.NewReader(nil))}, nil
+	}
+	return &http.Response{StatusCode: 200, Header: header, Body: ioutil.NopCloser(bytes.NewReader([]byte(index)))}, nil
+}
+
+func (f *fakeIndexServer) numRequests() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.requests)
+}
+
+func testIndex(version string) string {
+	return fmt.Sprintf("apiVersion: v1\nentries:\n  foo:\n  - name: foo\n    version: %s\n    urls: [foo-%s.tgz]\n", version, version)
+}
+
+func TestIndexCache(t *testing.T) {
+	server := &fakeIndexServer{index: testIndex("1.0.0"), etag: `"v1"`}
+	var netClient HTTPClient = server
+	getters := NewGetters(&netClient, "")
+	cache := NewIndexCache(time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	var downloads, downloadErrors int
+	cache.OnDownload = func(repoURL string, duration time.Duration, err error) {
+		downloads++
+		if err != nil {
+			downloadErrors++
+		}
+	}
+	indexURL := "http://charts.example.com/index.yaml"
+
+	fetch := func(authHeader, tlsIdentity, expectedVersion string) {
+		index, err := cache.Fetch(getters, indexURL, authHeader, tlsIdentity)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if v := index.Entries["foo"][0].Version; v != expectedVersion {
+			t.Errorf("Expected version %s received %s", expectedVersion, v)
+		}
+	}
+	checkStats := func(expected IndexCacheStats) {
+		if stats := cache.Stats(); stats != expected {
+			t.Errorf("Expected stats %+v received %+v", expected, stats)
+		}
+	}
+
+	fetch("", "", "1.0.0")
+	fetch("", "", "1.0.0")
+	checkStats(IndexCacheStats{Misses: 1, Hits: 1})
+	if n := server.numRequests(); n != 1 {
+		t.Errorf("Expected a single request, received %d", n)
+	}
+
+	// Other credentials have their own entry
+	fetch("Bearer t0k3n", "", "1.0.0")
+	checkStats(IndexCacheStats{Misses: 2, Hits: 1})
+
+	// Expired entries are revalidated
+	now = now.Add(2 * time.Minute)
+	fetch("", "", "1.0.0")
+	checkStats(IndexCacheStats{Misses: 2, Hits: 1, Revalidations: 1})
+	if h := server.requests[len(server.requests)-1].Header.Get("If-None-Match"); h != `"v1"` {
+		t.Errorf("Expected conditional request, received If-None-Match %q", h)
+	}
+	fetch("", "", "1.0.0")
+	checkStats(IndexCacheStats{Misses: 2, Hits: 2, Revalidations: 1})
+
+	// Refresh revalidates regardless of the age, downloading the
+	// index again once it changed
+	server.index, server.etag = testIndex("1.1.0"), `"v2"`
+	if _, err := cache.Refresh(getters, indexURL, "", ""); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	fetch("", "", "1.1.0")
+	checkStats(IndexCacheStats{Misses: 3, Hits: 3, Revalidations: 1})
+
+	if _, err := cache.Fetch(getters, "http://charts.example.com/other/index.yaml", "", ""); err == nil {
+		t.Errorf("Expected error fetching unknown index")
+	}
+	checkStats(IndexCacheStats{Misses: 3, Hits: 3, Revalidations: 1, Errors: 1})
+	if downloads != 5 || downloadErrors != 1 {
+		t.Errorf("Expected 5 downloads and 1 error, received %d and %d", downloads, downloadErrors)
+	}
+}
+
+func TestIndexCacheTLSIdentity(t *testing.T) {
+	server := &fakeIndexServer{index: testIndex("1.0.0"), etag: `"v1"`}
+	var netClient HTTPClient = server
+	getters := NewGetters(&netClient, "")
+	cache := NewIndexCache(time.Minute)
+	indexURL := "http://charts.example.com/index.yaml"
+
+	// Clients with another TLS certificate, or none, don't share the
+	// index fetched with a certificate
+	for _, tlsIdentity := range []string{"client-a", "client-a", "client-b", ""} {
+		if _, err := cache.Fetch(getters, indexURL, "", tlsIdentity); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	if stats := cache.Stats(); stats.Misses != 3 || stats.Hits != 1 {
+		t.Errorf("Expected 3 misses and 1 hit, received %+v", stats)
+	}
+}
+
+func TestIndexCacheConcurrentFetches(t *testing.T) {
+	server := &fakeIndexServer{index: testIndex("1.0.0"), etag: `"v1"`, release: make(chan struct{})}
+	var netClient HTTPClient = server
+	getters := NewGetters(&netClient, "")
+	cache := NewIndexCache(0)
+	indexURL := "http://charts.example.com/index.yaml"
+
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cache.Fetch(getters, indexURL, "", "")
+			errs <- err
+		}()
+	}
+	// Wait for all fetches to share the first one before letting it
+	// complete
+	for {
+		cache.mutex.Lock()
+		call := cache.calls[indexCacheKey(indexURL, "", "")]
+		joined := call != nil && call.dups == n-1
+		cache.mutex.Unlock()
+		if joined {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(server.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+	if r := server.numRequests(); r != 1 {
+		t.Errorf("Expected a single request, received %d", r)
+	}
+	if stats := cache.Stats(); stats.Misses != 1 || stats.Hits != n-1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
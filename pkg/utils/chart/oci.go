@@ -0,0 +1,314 @@
+package chart
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+const (
+	// OCIScheme is the URL scheme of charts stored in OCI registries
+	OCIScheme = "oci://"
+
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	// Media type of the chart archive layer, as pushed by helm
+	ociChartLayerMediaType = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	// Media type used by helm before the OCI support was stabilised
+	ociLegacyChartLayerMediaType = "application/tar+gzip"
+)
+
+// IsOCI returns true if ref is an oci:// chart reference
+func IsOCI(ref string) bool {
+	return strings.HasPrefix(strings.TrimSpace(ref), OCIScheme)
+}
+
+// OCIReference is a chart stored in an OCI registry
+type OCIReference struct {
+	// Registry is the registry host, with an optional port
+	Registry string
+	// Repository is the path of the chart within the registry
+	Repository string
+	// Tag is the chart version, with "+" replaced by "_". Empty if
+	// not yet resolved.
+	Tag string
+	// Digest of the manifest. Takes precedence over Tag if set.
+	Digest string
+}
+
+// ChartName returns the name of the chart, the last element of its
+// repository path
+func (r *OCIReference) ChartName() string {
+	return path.Base(r.Repository)
+}
+
+func (r *OCIReference) String() string {
+	s := OCIScheme + r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+func (r *OCIReference) manifestRef() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+var ociRepositoryRegexp = regexp.MustCompile(`^[a-z0-9]+(?:[._-][a-z0-9]+)*(?:/[a-z0-9]+(?:[._-][a-z0-9]+)*)*$`)
+
+// ParseOCIReference parses a reference of the form
+// oci://registry/repository[:tag][@digest]
+func ParseOCIReference(ref string) (*OCIReference, error) {
+	ref = strings.TrimSpace(ref)
+	if !IsOCI(ref) {
+		return nil, fmt.Errorf("%q is not an %s reference", ref, OCIScheme)
+	}
+	rest := strings.TrimPrefix(ref, OCIScheme)
+
+	r := &OCIReference{}
+	if i := strings.Index(rest, "@"); i != -1 {
+		rest, r.Digest = rest[:i], rest[i+1:]
+		if !strings.HasPrefix(r.Digest, "sha256:") {
+			return nil, fmt.Errorf("unsupported digest %q in %q", r.Digest, ref)
+		}
+	}
+	i := strings.Index(rest, "/")
+	if i == -1 {
+		return nil, fmt.Errorf("missing repository in %q", ref)
+	}
+	r.Registry, rest = rest[:i], rest[i+1:]
+	if j := strings.LastIndex(rest, ":"); j != -1 {
+		rest, r.Tag = rest[:j], rest[j+1:]
+	}
+	r.Repository = strings.TrimSuffix(rest, "/")
+	if r.Registry == "" || !ociRepositoryRegexp.MatchString(r.Repository) {
+		return nil, fmt.Errorf("invalid %s reference %q", OCIScheme, ref)
+	}
+	return r, nil
+}
+
+// OCITag returns the tag a chart version is stored as. OCI tags can't
+// contain "+", so helm replaces it with "_".
+func OCITag(version string) string {
+	return strings.Replace(version, "+", "_", -1)
+}
+
+// ociRegistry talks to a registry through the OCI distribution API
+type ociRegistry struct {
+	netClient  *HTTPClient
+	host       string
+	baseURL    string
+	authHeader string
+}
+
+func newOCIRegistry(netClient *HTTPClient, ref *OCIReference, authHeader string) *ociRegistry {
+	return &ociRegistry{
+		netClient:  netClient,
+		host:       ref.Registry,
+		baseURL:    "https://" + ref.Registry,
+		authHeader: authHeader,
+	}
+}
+
+// get performs a GET request against the registry. If the registry
+// asks for a bearer token, one is requested from its token service
+// (with the configured credentials, if any) and the request retried.
+func (o *ociRegistry) get(apiPath, accept string) ([]byte, error) {
+	do := func(authHeader string) (*http.Response, error) {
+		req, err := getReq(o.baseURL+apiPath, authHeader)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		return (*o.netClient).Do(req)
+	}
+
+	res, err := do(o.authHeader)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusUnauthorized {
+		challenge := res.Header.Get("WWW-Authenticate")
+		res.Body.Close()
+		token, err := o.token(challenge)
+		if err != nil {
+			return nil, err
+		}
+		res, err = do("Bearer " + token)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return readResponseBody(res)
+}
+
+var ociChallengeParamRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// token obtains a bearer token as described by a registry
+// WWW-Authenticate challenge. The credentials are only sent to a token
+// service on the registry host, the challenge can name any realm.
+func (o *ociRegistry) token(challenge string) (string, error) {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return "", fmt.Errorf("registry %s requires authentication", o.baseURL)
+	}
+	params := map[string]string{}
+	for _, m := range ociChallengeParamRegexp.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid authentication challenge from registry %s: %q", o.baseURL, challenge)
+	}
+	q := realm.Query()
+	for _, p := range []string{"service", "scope"} {
+		if params[p] != "" {
+			q.Set(p, params[p])
+		}
+	}
+	realm.RawQuery = q.Encode()
+
+	authHeader := o.authHeader
+	if !strings.EqualFold(realm.Host, o.host) {
+		authHeader = ""
+	}
+	req, err := getReq(realm.String(), authHeader)
+	if err != nil {
+		return "", err
+	}
+	res, err := (*o.netClient).Do(req)
+	if err != nil {
+		return "", err
+	}
+	data, err := readResponseBody(res)
+	if err != nil {
+		return "", fmt.Errorf("unable to get token for registry %s: %v", o.baseURL, err)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(data, &token); err != nil {
+		return "", err
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	if token.AccessToken != "" {
+		return token.AccessToken, nil
+	}
+	return "", fmt.Errorf("no token returned for registry %s", o.baseURL)
+}
+
+// ResolveOCIReference returns ref with its tag resolved: the given
+// version if ref has neither tag nor digest, or the newest version in
+// the repository matching version if it is a semver range or empty
+// (see ResolveVersion).
+func ResolveOCIReference(netClient *HTTPClient, ref *OCIReference, version string, prereleases bool, authHeader string) (*OCIReference, error) {
+	resolved := *ref
+	if resolved.Tag != "" || resolved.Digest != "" {
+		return &resolved, nil
+	}
+	if !IsVersionConstraint(version) {
+		resolved.Tag = OCITag(version)
+		return &resolved, nil
+	}
+
+	data, err := newOCIRegistry(netClient, ref, authHeader).get(fmt.Sprintf("/v2/%s/tags/list", ref.Repository), "")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list tags of %s: %v", ref, err)
+	}
+	var tags struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return nil, err
+	}
+	versions := make([]string, 0, len(tags.Tags))
+	for _, tag := range tags.Tags {
+		versions = append(versions, strings.Replace(tag, "_", "+", -1))
+	}
+	latest, err := ResolveVersion(versions, version, prereleases)
+	if err != nil {
+		return nil, fmt.Errorf("no chart versions found in %s: %v", ref, err)
+	}
+	resolved.Tag = OCITag(latest)
+	return &resolved, nil
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+// FetchOCIChart returns the chart stored at a resolved OCI reference
+func FetchOCIChart(netClient *HTTPClient, ref *OCIReference, authHeader string, load LoadChart) (*chart.Chart, error) {
+	if ref.manifestRef() == "" {
+		return nil, fmt.Errorf("unresolved reference %s", ref)
+	}
+	registry := newOCIRegistry(netClient, ref, authHeader)
+
+	data, err := registry.get(fmt.Sprintf("/v2/%s/manifests/%s", ref.Repository, ref.manifestRef()), ociManifestMediaType)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch manifest of %s: %v", ref, err)
+	}
+	if ref.Digest != "" {
+		if err := checkOCIDigest(ref.Digest, data); err != nil {
+			return nil, fmt.Errorf("manifest of %s: %v", ref, err)
+		}
+	}
+	manifest := ociManifest{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest of %s: %v", ref, err)
+	}
+
+	var layer *ociDescriptor
+	for i := range manifest.Layers {
+		switch manifest.Layers[i].MediaType {
+		case ociChartLayerMediaType, ociLegacyChartLayerMediaType:
+			layer = &manifest.Layers[i]
+		}
+	}
+	if layer == nil {
+		return nil, fmt.Errorf("%s has no chart layer", ref)
+	}
+
+	data, err = registry.get(fmt.Sprintf("/v2/%s/blobs/%s", ref.Repository, layer.Digest), "")
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch chart layer of %s: %v", ref, err)
+	}
+	if err := checkOCIDigest(layer.Digest, data); err != nil {
+		return nil, fmt.Errorf("chart layer of %s: %v", ref, err)
+	}
+	return load(bytes.NewReader(data))
+}
+
+func checkOCIDigest(digest string, data []byte) error {
+	if !strings.HasPrefix(digest, "sha256:") {
+		return fmt.Errorf("unsupported digest %q", digest)
+	}
+	if actual := fmt.Sprintf("sha256:%x", sha256.Sum256(data)); actual != digest {
+		return fmt.Errorf("digest mismatch, expected %s received %s", digest, actual)
+	}
+	return nil
+}
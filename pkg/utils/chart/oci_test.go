@@ -0,0 +1,278 @@
+package chart
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+// fakeRegistry serves charts through the OCI distribution API. Charts
+// are stored as map[repository]map[tag]content.
+type fakeRegistry struct {
+	charts map[string]map[string]string
+	// token required as a bearer token, if set
+	token string
+}
+
+func ociDigest(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+func (f *fakeRegistry) manifest(content string) []byte {
+	m := ociManifest{
+		SchemaVersion: 2,
+		Layers: []ociDescriptor{
+			{MediaType: ociChartLayerMediaType, Digest: ociDigest([]byte(content)), Size: int64(len(content))},
+		},
+	}
+	data, _ := json.Marshal(m)
+	return data
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		if r.URL.Query().Get("scope") == "" {
+			http.Error(w, "missing scope", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"token": f.token})
+		return
+	}
+	if f.token != "" && r.Header.Get("Authorization") != "Bearer "+f.token {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="https://%s/token",service="fake",scope="repository:charts:pull"`, r.Host))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	for repo, tags := range f.charts {
+		prefix := "/v2/" + repo + "/"
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			continue
+		}
+		switch rest := strings.TrimPrefix(r.URL.Path, prefix); {
+		case rest == "tags/list":
+			var list []string
+			for tag := range tags {
+				list = append(list, tag)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"name": repo, "tags": list})
+			return
+		case strings.HasPrefix(rest, "manifests/"):
+			ref := strings.TrimPrefix(rest, "manifests/")
+			for tag, content := range tags {
+				m := f.manifest(content)
+				if ref == tag || ref == ociDigest(m) {
+					w.Header().Set("Content-Type", ociManifestMediaType)
+					w.Write(m)
+					return
+				}
+			}
+		case strings.HasPrefix(rest, "blobs/"):
+			digest := strings.TrimPrefix(rest, "blobs/")
+			for _, content := range tags {
+				if ociDigest([]byte(content)) == digest {
+					io.WriteString(w, content)
+					return
+				}
+			}
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func loadTestChart(in io.Reader) (*chart.Chart, error) {
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	return &chart.Chart{Metadata: &chart.Metadata{Description: string(data)}}, nil
+}
+
+func newFakeRegistry(registry *fakeRegistry) (*httptest.Server, HTTPClient, string) {
+	server := httptest.NewTLSServer(registry)
+	var netClient HTTPClient = server.Client()
+	return server, netClient, strings.TrimPrefix(server.URL, "https://")
+}
+
+func TestParseOCIReference(t *testing.T) {
+	tests := []struct {
+		ref      string
+		expected *OCIReference
+	}{
+		{"oci://registry.example.com/charts/mariadb", &OCIReference{Registry: "registry.example.com", Repository: "charts/mariadb"}},
+		{"oci://localhost:5000/mariadb:1.0.0_build.1", &OCIReference{Registry: "localhost:5000", Repository: "mariadb", Tag: "1.0.0_build.1"}},
+		{"oci://registry.example.com/charts/mariadb@sha256:abc", &OCIReference{Registry: "registry.example.com", Repository: "charts/mariadb", Digest: "sha256:abc"}},
+		{"oci://registry.example.com/charts/mariadb:1.0.0@sha256:abc", &OCIReference{Registry: "registry.example.com", Repository: "charts/mariadb", Tag: "1.0.0", Digest: "sha256:abc"}},
+		{"oci://registry.example.com", nil},
+		{"oci://registry.example.com/Charts", nil},
+		{"https://registry.example.com/charts/mariadb", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			res, err := ParseOCIReference(tt.ref)
+			if tt.expected == nil {
+				if err == nil {
+					t.Errorf("Expected error, received %v", res)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if *res != *tt.expected {
+				t.Errorf("Expected %v received %v", tt.expected, res)
+			}
+			if res.String() != tt.ref {
+				t.Errorf("Expected %s received %s", tt.ref, res.String())
+			}
+		})
+	}
+}
+
+func TestResolveOCIReference(t *testing.T) {
+	registry := &fakeRegistry{charts: map[string]map[string]string{
+		"charts/mariadb": {"1.0.0": "", "1.2.0_build.1": "", "1.10.0": "", "2.0.0-beta.1": "", "latest": ""},
+		"charts/empty":   {},
+	}}
+	server, netClient, host := newFakeRegistry(registry)
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		ref         string
+		version     string
+		prereleases bool
+		expected    string
+	}{
+		{"tag", "oci://%s/charts/mariadb:1.0.0", "2.0.0", false, "1.0.0"},
+		{"version", "oci://%s/charts/mariadb", "1.2.0+build.1", false, "1.2.0_build.1"},
+		{"latest", "oci://%s/charts/mariadb", "", false, "1.10.0"},
+		{"range", "oci://%s/charts/mariadb", "~1.2", false, "1.2.0_build.1"},
+		{"prereleases", "oci://%s/charts/mariadb", ">=1.0", true, "2.0.0-beta.1"},
+		{"no matching version", "oci://%s/charts/mariadb", "^3", false, ""},
+		{"no versions", "oci://%s/charts/empty", "", false, ""},
+		{"unknown repository", "oci://%s/charts/other", "", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := ParseOCIReference(fmt.Sprintf(tt.ref, host))
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			res, err := ResolveOCIReference(&netClient, ref, tt.version, tt.prereleases, "")
+			if tt.expected == "" {
+				if err == nil {
+					t.Errorf("Expected error, received %v", res)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if res.Tag != tt.expected {
+				t.Errorf("Expected tag %s received %s", tt.expected, res.Tag)
+			}
+		})
+	}
+}
+
+func TestFetchOCIChart(t *testing.T) {
+	registry := &fakeRegistry{
+		charts: map[string]map[string]string{
+			"charts/mariadb": {"1.0.0": "mariadb 1.0.0", "1.1.0": "mariadb 1.1.0"},
+		},
+		token: "s3cr3t",
+	}
+	server, netClient, host := newFakeRegistry(registry)
+	defer server.Close()
+
+	manifestDigest := ociDigest(registry.manifest("mariadb 1.1.0"))
+	tests := []struct {
+		name     string
+		ref      string
+		expected string
+	}{
+		{"tag", "oci://%s/charts/mariadb:1.0.0", "mariadb 1.0.0"},
+		{"digest", "oci://%s/charts/mariadb@" + manifestDigest, "mariadb 1.1.0"},
+		{"wrong digest", "oci://%s/charts/mariadb@sha256:0000", ""},
+		{"unknown tag", "oci://%s/charts/mariadb:2.0.0", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := ParseOCIReference(fmt.Sprintf(tt.ref, host))
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			res, err := FetchOCIChart(&netClient, ref, "", loadTestChart)
+			if tt.expected == "" {
+				if err == nil {
+					t.Errorf("Expected error, received %v", res)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if res.Metadata.Description != tt.expected {
+				t.Errorf("Expected %q received %q", tt.expected, res.Metadata.Description)
+			}
+		})
+	}
+}
+
+func TestOCITokenRealm(t *testing.T) {
+	var tokenAuth string
+	tokens := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenAuth = r.Header.Get("Authorization")
+		json.NewEncoder(w).Encode(map[string]string{"token": "s3cr3t"})
+	}))
+	defer tokens.Close()
+	realm := tokens.URL
+	registry := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			tokenAuth = r.Header.Get("Authorization")
+			json.NewEncoder(w).Encode(map[string]string{"token": "s3cr3t"})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer s3cr3t" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake"`, realm))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"tags": []string{"1.0.0"}})
+	}))
+	defer registry.Close()
+	var netClient HTTPClient = registry.Client()
+	ref, err := ParseOCIReference(fmt.Sprintf("oci://%s/charts/mariadb", strings.TrimPrefix(registry.URL, "https://")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		realm    string
+		expected string
+	}{
+		{"registry host", registry.URL, "Basic Zm9vOmJhcg=="},
+		{"other host", tokens.URL, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			realm, tokenAuth = tt.realm, "unset"
+			if _, err := ResolveOCIReference(&netClient, ref, "", false, "Basic Zm9vOmJhcg=="); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if tokenAuth != tt.expected {
+				t.Errorf("Expected Authorization header %q for the token service received %q", tt.expected, tokenAuth)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package chart
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+	"k8s.io/helm/pkg/provenance"
+)
+
+// ProvenanceExt is the extension of chart provenance files, served
+// next to chart archives
+const ProvenanceExt = ".prov"
+
+// VerificationError is returned when a chart doesn't match its
+// expected digest or provenance
+type VerificationError struct {
+	err error
+}
+
+func (e *VerificationError) Error() string {
+	return e.err.Error()
+}
+
+// IsVerificationError returns true if err is a VerificationError
+func IsVerificationError(err error) bool {
+	_, ok := err.(*VerificationError)
+	return ok
+}
+
+// VerifyDigest checks that data has the given sha256 digest, as found
+// in repository indexes (hex encoded, optionally prefixed by
+// "sha256:"). An empty digest is not checked.
+func VerifyDigest(data []byte, digest string) error {
+	if digest == "" {
+		return nil
+	}
+	expected := strings.TrimPrefix(strings.ToLower(digest), "sha256:")
+	if actual := fmt.Sprintf("%x", sha256.Sum256(data)); actual != expected {
+		return &VerificationError{fmt.Errorf("digest mismatch, expected sha256:%s received sha256:%s", expected, actual)}
+	}
+	return nil
+}
+
+// readKeyring parses a binary or ASCII armored public keyring
+func readKeyring(keyring []byte) (openpgp.EntityList, error) {
+	if ring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(keyring)); err == nil {
+		return ring, nil
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(keyring))
+}
+
+// VerifyProvenance checks that the chart archive downloaded from
+// chartURL is signed, in its provenance file prov, by one of the keys
+// in keyring. It returns the verification details, including the
+// signer.
+func VerifyProvenance(archive, prov []byte, chartURL string, keyring []byte) (*provenance.Verification, error) {
+	ring, err := readKeyring(keyring)
+	if err != nil {
+		return nil, &VerificationError{fmt.Errorf("invalid keyring: %v", err)}
+	}
+
+	// provenance only verifies files, named as in the provenance file
+	dir, err := ioutil.TempDir("", "helm-crd-verify")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	name := path.Base(strings.SplitN(chartURL, "?", 2)[0])
+	archivePath := filepath.Join(dir, name)
+	provPath := archivePath + ProvenanceExt
+	if err := ioutil.WriteFile(archivePath, archive, 0644); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(provPath, prov, 0644); err != nil {
+		return nil, err
+	}
+
+	signatory := &provenance.Signatory{KeyRing: ring}
+	ver, err := signatory.Verify(archivePath, provPath)
+	if err != nil {
+		return nil, &VerificationError{fmt.Errorf("provenance verification of %s failed: %v", chartURL, err)}
+	}
+	return ver, nil
+}
+
+// FetchProvenance returns the provenance file of the chart at chartURL,
+// served at the same URL with ProvenanceExt appended to its path
+func FetchProvenance(getter Getter, chartURL, authHeader string) ([]byte, error) {
+	u, err := url.Parse(chartURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path += ProvenanceExt
+	if u.RawPath != "" {
+		u.RawPath += ProvenanceExt
+	}
+	return getter.Get(u.String(), authHeader)
+}
@@ -0,0 +1,149 @@
+package chart
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/provenance"
+)
+
+func TestVerifyDigest(t *testing.T) {
+	data := []byte("chart")
+	digest := "cc57fc1903e444cf6a726490b43b27ee9f87facc037f86872201847c565b45fb"
+	tests := []struct {
+		digest string
+		valid  bool
+	}{
+		{"", true},
+		{digest, true},
+		{"sha256:" + digest, true},
+		{"0000", false},
+	}
+	for _, tt := range tests {
+		err := VerifyDigest(data, tt.digest)
+		if tt.valid && err != nil {
+			t.Errorf("Unexpected error verifying %q: %v", tt.digest, err)
+		}
+		if !tt.valid && !IsVerificationError(err) {
+			t.Errorf("Expected verification error verifying %q, received %v", tt.digest, err)
+		}
+	}
+}
+
+// signedTestChart returns a chart archive, its provenance file signed
+// by a new key, and the public keyring of the key
+func signedTestChart(t *testing.T) ([]byte, []byte, []byte) {
+	dir, err := ioutil.TempDir("", "verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	archivePath, err := chartutil.Save(&chart.Chart{Metadata: &chart.Metadata{Name: "foo", Version: "1.0.0", ApiVersion: chartutil.ApiVersionV1}}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := ioutil.ReadFile(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entity, err := openpgp.NewEntity("Chart Signer", "", "signer@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prov, err := (&provenance.Signatory{Entity: entity}).ClearSign(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := &bytes.Buffer{}
+	if err := entity.Serialize(keyring); err != nil {
+		t.Fatal(err)
+	}
+	return archive, []byte(prov), keyring.Bytes()
+}
+
+func TestVerifyProvenance(t *testing.T) {
+	archive, prov, keyring := signedTestChart(t)
+	_, _, otherKeyring := signedTestChart(t)
+	armored := &bytes.Buffer{}
+	w, err := armor.Encode(armored, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(keyring)
+	w.Close()
+	tampered := append([]byte{}, archive...)
+	tampered[len(tampered)-1] ^= 0xff
+
+	chartURL := "http://charts.example.com/foo-1.0.0.tgz"
+	tests := []struct {
+		name     string
+		archive  []byte
+		prov     []byte
+		chartURL string
+		keyring  []byte
+		valid    bool
+	}{
+		{"binary keyring", archive, prov, chartURL, keyring, true},
+		{"armored keyring", archive, prov, chartURL, armored.Bytes(), true},
+		{"other key", archive, prov, chartURL, otherKeyring, false},
+		{"invalid keyring", archive, prov, chartURL, []byte("keyring"), false},
+		{"tampered archive", tampered, prov, chartURL, keyring, false},
+		{"unsigned file name", archive, prov, "http://charts.example.com/bar-1.0.0.tgz", keyring, false},
+		{"invalid provenance", archive, []byte("prov"), chartURL, keyring, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ver, err := VerifyProvenance(tt.archive, tt.prov, tt.chartURL, tt.keyring)
+			if !tt.valid {
+				if !IsVerificationError(err) {
+					t.Errorf("Expected verification error, received %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if _, ok := ver.SignedBy.Identities["Chart Signer <signer@example.com>"]; !ok {
+				t.Errorf("Unexpected signer %v", ver.SignedBy.Identities)
+			}
+		})
+	}
+}
+
+// urlGetter records the URLs it gets
+type urlGetter struct {
+	urls []string
+}
+
+func (g *urlGetter) Get(rawURL, authHeader string) ([]byte, error) {
+	g.urls = append(g.urls, rawURL)
+	return nil, nil
+}
+
+func TestFetchProvenance(t *testing.T) {
+	tests := []struct {
+		chartURL string
+		expected string
+	}{
+		{"http://charts.example.com/foo-1.0.0.tgz", "http://charts.example.com/foo-1.0.0.tgz.prov"},
+		{"https://charts.example.com/foo-1.0.0.tgz?token=abc&x=1", "https://charts.example.com/foo-1.0.0.tgz.prov?token=abc&x=1"},
+		{"http://charts.example.com/foo%2Fbar-1.0.0.tgz", "http://charts.example.com/foo%2Fbar-1.0.0.tgz.prov"},
+		{"file:///charts/foo-1.0.0.tgz", "file:///charts/foo-1.0.0.tgz.prov"},
+	}
+	for _, tt := range tests {
+		getter := &urlGetter{}
+		if _, err := FetchProvenance(getter, tt.chartURL, ""); err != nil {
+			t.Errorf("%s: unexpected error %v", tt.chartURL, err)
+		}
+		if len(getter.urls) != 1 || getter.urls[0] != tt.expected {
+			t.Errorf("%s: expected %s received %v", tt.chartURL, tt.expected, getter.urls)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package chart
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+// Space separated constraints, as in ">=1.2 <2", which the semver
+// library only accepts separated by commas
+var constraintSeparatorRegexp = regexp.MustCompile(`([0-9A-Za-z*])\s+([<>=!~^])`)
+
+// IsVersionConstraint returns true if version is a semver range (eg:
+// "~2.0" or ">=1.2 <2") rather than a single version. An empty version
+// matches any version.
+func IsVersionConstraint(version string) bool {
+	version = strings.TrimSpace(version)
+	if version == "" || strings.ContainsAny(version, "<>=!~^*, |") {
+		return true
+	}
+	// Wildcards ("1.2.x") don't parse, partial versions ("1.2") match
+	// any patch version
+	if _, err := semver.NewVersion(version); err != nil {
+		return true
+	}
+	return strings.Count(strings.SplitN(version, "-", 2)[0], ".") < 2
+}
+
+// ResolveVersion returns the newest of versions matching constraint
+// (any version if empty). Pre-release versions only match if
+// prereleases is set (matching the constraint by their release
+// version), or if the constraint names a pre-release.
+// Versions that aren't valid semver are ignored.
+func ResolveVersion(versions []string, constraint string, prereleases bool) (string, error) {
+	if constraint == "" {
+		constraint = "*"
+	}
+	c, err := semver.NewConstraint(constraintSeparatorRegexp.ReplaceAllString(constraint, "$1, $2"))
+	if err != nil {
+		return "", fmt.Errorf("invalid version %q: %v", constraint, err)
+	}
+
+	var latest *semver.Version
+	resolved := ""
+	for _, version := range versions {
+		v, err := semver.NewVersion(version)
+		if err != nil {
+			continue
+		}
+		if !c.Check(v) && !(prereleases && v.Prerelease() != "" && c.Check(release(v))) {
+			continue
+		}
+		if latest == nil || v.GreaterThan(latest) {
+			latest, resolved = v, version
+		}
+	}
+	if latest == nil {
+		return "", fmt.Errorf("no version matches %q", constraint)
+	}
+	return resolved, nil
+}
+
+// release returns v without its pre-release part, which constraints
+// otherwise never match
+func release(v *semver.Version) *semver.Version {
+	r, err := v.SetPrerelease("")
+	if err != nil {
+		return v
+	}
+	return &r
+}
@@ -0,0 +1,101 @@
+package chart
+
+import (
+	"testing"
+
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/repo"
+)
+
+func TestIsVersionConstraint(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected bool
+	}{
+		{"", true},
+		{"1.2.3", false},
+		{"v1.2.3", false},
+		{"1.2.3-rc.1", false},
+		{"1.2.3+build.1", false},
+		{"1.2", true},
+		{"1.2.x", true},
+		{"~2.0", true},
+		{"^1", true},
+		{">=1.2 <2", true},
+		{"1.2.3 || 2.0.0", true},
+	}
+	for _, tt := range tests {
+		if res := IsVersionConstraint(tt.version); res != tt.expected {
+			t.Errorf("IsVersionConstraint(%q): expected %v received %v", tt.version, tt.expected, res)
+		}
+	}
+}
+
+func TestResolveVersion(t *testing.T) {
+	versions := []string{"1.0.0", "1.2.0", "1.2.3", "1.10.0", "2.0.0-rc.1", "2.0.1", "2.1.0-beta.1", "latest"}
+	tests := []struct {
+		name        string
+		constraint  string
+		prereleases bool
+		expected    string
+	}{
+		{"latest", "", false, "2.0.1"},
+		{"latest with pre-releases", "", true, "2.1.0-beta.1"},
+		{"exact", "1.2.0", false, "1.2.0"},
+		{"tilde", "~1.2", false, "1.2.3"},
+		{"range", ">=1.2 <2.0.0", false, "1.10.0"},
+		{"tilde with pre-releases", "~2.0", true, "2.0.1"},
+		{"caret with pre-releases", "^2", true, "2.1.0-beta.1"},
+		{"pre-release constraint", ">=2.1.0-alpha", false, "2.1.0-beta.1"},
+		{"no match", "^3", true, ""},
+		{"invalid", "not a version", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := ResolveVersion(versions, tt.constraint, tt.prereleases)
+			if tt.expected == "" {
+				if err == nil {
+					t.Errorf("Expected error, received %s", res)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if res != tt.expected {
+				t.Errorf("Expected %s received %s", tt.expected, res)
+			}
+		})
+	}
+}
+
+func TestFindChartVersionInRepoIndex(t *testing.T) {
+	index := repo.NewIndexFile()
+	for _, v := range []string{"1.0.0", "1.1.0", "2.0.0-rc.1"} {
+		index.Add(&chart.Metadata{Name: "foo", Version: v}, "foo-"+v+".tgz", "http://charts.example.com/", "")
+	}
+	index.SortEntries()
+
+	cv, err := FindChartVersionInRepoIndex(index, "foo", "^1.0", false)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if cv.Version != "1.1.0" || cv.URLs[0] != "http://charts.example.com/foo-1.1.0.tgz" {
+		t.Errorf("Unexpected chart version %v", cv)
+	}
+
+	cv, err = FindChartVersionInRepoIndex(index, "foo", "", true)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if cv.Version != "2.0.0-rc.1" {
+		t.Errorf("Expected 2.0.0-rc.1 received %s", cv.Version)
+	}
+
+	if _, err := FindChartVersionInRepoIndex(index, "foo", "~1.2", false); err == nil {
+		t.Errorf("Expected error for an unmatched version")
+	}
+	if _, err := FindChartVersionInRepoIndex(index, "bar", "", false); err == nil {
+		t.Errorf("Expected error for an unknown chart")
+	}
+}